@@ -1,8 +1,14 @@
 module github.com/raghuP9/amqp
 
-go 1.13
+go 1.18
 
 require (
 	github.com/streadway/amqp v1.0.0
 	github.com/urfave/cli/v2 v2.2.0
 )
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+)
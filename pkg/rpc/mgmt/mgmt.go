@@ -0,0 +1,239 @@
+/*
+Package mgmt is a small client for the HTTP API of the RabbitMQ management
+plugin. AMQP has no way to list exchanges, queues or bindings, the management
+API has, so tooling built on package rmq can use this package to introspect
+the broker.
+
+The management plugin must be enabled on the server, it listens on port
+15672 by default, 15671 with TLS.
+*/
+package mgmt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Default ports of the management plugin
+const (
+	DefaultPort       = "15672"
+	DefaultSecurePort = "15671"
+)
+
+// defaultTimeout bounds requests of clients without an http.Client of their own
+const defaultTimeout = 30 * time.Second
+
+// Error is returned when the management API answers with an error status,
+// e.g. 404 for an unknown queue or 401 for bad credentials
+type Error struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("management API returned %d: %s", e.StatusCode, e.Reason)
+}
+
+// IsNotFound reports whether err was caused by the management API not
+// finding the requested object, e.g. a queue or the vhost
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Queue is a queue as reported by the management API
+type Queue struct {
+	Name       string                 `json:"name"`
+	Vhost      string                 `json:"vhost"`
+	Type       string                 `json:"type"` // classic, quorum or stream
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Exclusive  bool                   `json:"exclusive"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	State      string                 `json:"state"`
+
+	Messages               int `json:"messages"`
+	MessagesReady          int `json:"messages_ready"`
+	MessagesUnacknowledged int `json:"messages_unacknowledged"`
+	Consumers              int `json:"consumers"`
+}
+
+// Binding is a binding of a queue or an exchange to an exchange as
+// reported by the management API. Source is "" for the bindings of
+// the default exchange every queue has.
+type Binding struct {
+	Source          string                 `json:"source"`
+	Vhost           string                 `json:"vhost"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"` // queue or exchange
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
+}
+
+// Client is a management API client for a single vhost. A client is
+// safe for concurrent use by multiple goroutines.
+type Client struct {
+	base     string // scheme, host and port
+	username string
+	password string
+	vhost    string
+
+	mu   sync.RWMutex
+	http *http.Client
+}
+
+/*
+GetMgmtClient returns a management API client, taking the same arguments as
+rmq.GetRMQClient except for the port, which is the port of the management
+plugin, e.g. DefaultPort.
+
+vhost is given as for rmq.GetRMQClient, "/" for the default vhost and
+"/orders" for the vhost orders
+
+secure makes the client use https
+*/
+func GetMgmtClient(
+	username, password, url, port, vhost string,
+	secure bool) *Client {
+
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+
+	return &Client{
+		base:     fmt.Sprintf("%s://%s:%s", scheme, url, port),
+		username: username,
+		password: password,
+		vhost:    vhostName(vhost),
+		http:     &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// vhostName returns the name of the vhost given as the path of an AMQP URI
+func vhostName(vhost string) string {
+	if vhost == "" || vhost == "/" {
+		return "/"
+	}
+	return strings.TrimPrefix(vhost, "/")
+}
+
+/*
+NewClientFromURI returns a management API client for the broker of the AMQP
+URI uri, e.g. the one passed to rmq.NewClient, reusing its host, credentials
+and vhost. The management API is reached on DefaultPort, or on
+DefaultSecurePort with https for amqps URIs.
+*/
+func NewClientFromURI(uri string) (*Client, error) {
+	u, err := amqp.ParseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AMQP URI: %w", err)
+	}
+
+	port := DefaultPort
+	if u.Scheme == "amqps" {
+		port = DefaultSecurePort
+	}
+	c := GetMgmtClient(u.Username, u.Password, u.Host, port, "", u.Scheme == "amqps")
+	c.vhost = u.Vhost // already unescaped by amqp.ParseURI
+	return c, nil
+}
+
+// SetHTTPClient sets the http.Client used for requests, e.g. to configure
+// TLS or a different timeout. nil restores the default client.
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hc == nil {
+		hc = &http.Client{Timeout: defaultTimeout}
+	}
+	c.http = hc
+}
+
+// ListQueues returns the queues of the vhost of the client
+func (c *Client) ListQueues(ctx context.Context) ([]Queue, error) {
+	var queues []Queue
+	if err := c.get(ctx, &queues, "queues", c.vhost); err != nil {
+		return nil, fmt.Errorf("list queues: %w", err)
+	}
+	return queues, nil
+}
+
+// GetQueue returns the queue name of the vhost of the client, the error
+// satisfies IsNotFound if there is no such queue
+func (c *Client) GetQueue(ctx context.Context, name string) (Queue, error) {
+	var queue Queue
+	if err := c.get(ctx, &queue, "queues", c.vhost, name); err != nil {
+		return Queue{}, fmt.Errorf("get queue [%s]: %w", name, err)
+	}
+	return queue, nil
+}
+
+// ListBindings returns the bindings of the vhost of the client
+func (c *Client) ListBindings(ctx context.Context) ([]Binding, error) {
+	var bindings []Binding
+	if err := c.get(ctx, &bindings, "bindings", c.vhost); err != nil {
+		return nil, fmt.Errorf("list bindings: %w", err)
+	}
+	return bindings, nil
+}
+
+// get requests the API path made of the escaped segments and decodes
+// the JSON response into v
+func (c *Client) get(ctx context.Context, v interface{}, segments ...string) error {
+	path := make([]string, len(segments))
+	for i, s := range segments {
+		// the default vhost "/" must be sent as %2F
+		path[i] = url.PathEscape(s)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.base+"/api/"+strings.Join(path, "/"), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", "application/json")
+
+	c.mu.RLock()
+	hc := c.http
+	c.mu.RUnlock()
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// apiError returns the *Error for a response with an error status,
+// the API explains the error in a JSON body
+func apiError(resp *http.Response) error {
+	var body struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+
+	reason := http.StatusText(resp.StatusCode)
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &body) == nil && body.Reason != "" {
+		reason = body.Reason
+	}
+	return &Error{StatusCode: resp.StatusCode, Reason: reason}
+}
@@ -0,0 +1,146 @@
+package mgmt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testServer serves canned responses of the management API by escaped
+// path, checking the credentials of every request
+func testServer(t *testing.T, responses map[string]string) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "guest" || pass != "secret" {
+			t.Errorf("%s: basic auth = %q, %q, %v, want guest, secret", r.URL, user, pass, ok)
+		}
+		if accept := r.Header.Get("Accept"); accept != "application/json" {
+			t.Errorf("%s: Accept = %q, want application/json", r.URL, accept)
+		}
+
+		body, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Object Not Found","reason":"Not Found"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return GetMgmtClient("guest", "secret", host, port, "/", false)
+}
+
+func TestListQueues(t *testing.T) {
+	c := testServer(t, map[string]string{
+		"/api/queues/%2F": `[
+			{"name":"orders","vhost":"/","type":"quorum","durable":true,
+			 "arguments":{"x-queue-type":"quorum"},"messages":3,"consumers":1},
+			{"name":"amq.gen-1","vhost":"/","type":"classic","exclusive":true,"auto_delete":true}
+		]`,
+	})
+
+	queues, err := c.ListQueues(context.Background())
+	if err != nil {
+		t.Fatalf("ListQueues: %v", err)
+	}
+	if len(queues) != 2 {
+		t.Fatalf("ListQueues returned %d queues, want 2", len(queues))
+	}
+	q := queues[0]
+	if q.Name != "orders" || q.Vhost != "/" || q.Type != "quorum" || !q.Durable ||
+		q.Messages != 3 || q.Consumers != 1 || q.Arguments["x-queue-type"] != "quorum" {
+		t.Errorf("queues[0] = %+v", q)
+	}
+	if q := queues[1]; !q.Exclusive || !q.AutoDelete || q.Durable {
+		t.Errorf("queues[1] = %+v", q)
+	}
+}
+
+func TestGetQueue(t *testing.T) {
+	c := testServer(t, map[string]string{
+		"/api/queues/%2F/orders%2Fpriority": `{"name":"orders/priority","vhost":"/","messages_ready":2,"messages_unacknowledged":1}`,
+	})
+
+	q, err := c.GetQueue(context.Background(), "orders/priority")
+	if err != nil {
+		t.Fatalf("GetQueue: %v", err)
+	}
+	if q.Name != "orders/priority" || q.MessagesReady != 2 || q.MessagesUnacknowledged != 1 {
+		t.Errorf("GetQueue = %+v", q)
+	}
+
+	_, err = c.GetQueue(context.Background(), "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("GetQueue of a missing queue = %v, want an error satisfying IsNotFound", err)
+	}
+	if want := "get queue [missing]: management API returned 404: Not Found"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestListBindings(t *testing.T) {
+	c := testServer(t, map[string]string{
+		"/api/bindings/%2F": `[
+			{"source":"","vhost":"/","destination":"orders","destination_type":"queue","routing_key":"orders"},
+			{"source":"events","vhost":"/","destination":"audit","destination_type":"exchange",
+			 "routing_key":"#","arguments":{"x-match":"all"}}
+		]`,
+	})
+
+	bindings, err := c.ListBindings(context.Background())
+	if err != nil {
+		t.Fatalf("ListBindings: %v", err)
+	}
+	if len(bindings) != 2 {
+		t.Fatalf("ListBindings returned %d bindings, want 2", len(bindings))
+	}
+	if b := bindings[0]; b.Source != "" || b.Destination != "orders" || b.DestinationType != "queue" {
+		t.Errorf("bindings[0] = %+v", b)
+	}
+	if b := bindings[1]; b.Source != "events" || b.DestinationType != "exchange" ||
+		b.RoutingKey != "#" || b.Arguments["x-match"] != "all" {
+		t.Errorf("bindings[1] = %+v", b)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized) // no JSON body
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	c := GetMgmtClient("guest", "wrong", host, port, "/orders", false)
+
+	_, err := c.ListQueues(context.Background())
+	if err == nil || IsNotFound(err) {
+		t.Fatalf("ListQueues = %v, want a 401 error not satisfying IsNotFound", err)
+	}
+	if want := "list queues: management API returned 401: Unauthorized"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestVhostName(t *testing.T) {
+	for vhost, want := range map[string]string{"": "/", "/": "/", "/orders": "orders", "orders": "orders"} {
+		if got := vhostName(vhost); got != want {
+			t.Errorf("vhostName(%q) = %q, want %q", vhost, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Confirmation is the pending confirmation of a publishing
+// sent with Session.PublishAsync
+type Confirmation struct {
+	tag  uint64
+	done <-chan confirmation
+
+	exchange, key string
+
+	mu     sync.Mutex
+	waited bool
+	err    error
+}
+
+// DeliveryTag is the delivery tag of the publishing on the session channel,
+// tags start at 1 and are incremented for every publishing of the session
+func (c *Confirmation) DeliveryTag() uint64 {
+	return c.tag
+}
+
+/*
+Wait blocks until the server confirmed the publishing and returns nil if it
+was acked, ErrPublishNacked if it was nacked, a *ReturnError if it was
+returned as unroutable and ErrConfirmLost if the channel closed first.
+
+If ctx is done first Wait returns ctx.Err() and may be called again. Once
+the outcome is known every call returns it right away.
+*/
+func (c *Confirmation) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.waited {
+		return c.err
+	}
+
+	select {
+	case conf, ok := <-c.done:
+		c.waited = true
+		if err := conf.err(ok); err != nil {
+			c.err = fmt.Errorf("publish to exchange [%s] with key [%s]: %w", c.exchange, c.key, err)
+		}
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+PublishAsync is like PublishContext with opts.Confirm set, but returns as
+soon as the message is written instead of waiting for the confirmation. Wait
+on the returned Confirmation, e.g. to keep a bounded number of publishings
+in flight. opts.ConfirmTimeout is not applied, bound Wait with its ctx.
+
+The confirmations are lost when the session closes, so keep the session
+open until all returned confirmations have been waited for. Metrics report
+the publishing once it is written.
+*/
+func (s *Session) PublishAsync(
+	ctx context.Context,
+	msg amqp.Publishing,
+	exchange, key string,
+	opts *PublishOpts) (conf *Confirmation, err error) {
+
+	defaultOpts := *DefaultPublishOpts()
+
+	if opts != nil {
+		defaultOpts = *opts
+	}
+	defaultOpts.Confirm = true
+
+	if s.metrics != nil {
+		defer func(start time.Time) {
+			s.onPublish(exchange, key, err, start)
+		}(time.Now())
+	}
+
+	if err = checkKey(key); err != nil {
+		return nil, err
+	}
+
+	msg = s.inject(ctx, msg)
+
+	var tag uint64
+	var done <-chan confirmation
+	err = s.do(ctx, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var err error
+		tag, done, err = s.publish(msg, exchange, key, &defaultOpts)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("publish to exchange [%s] with key [%s]: %w", exchange, key, err)
+	}
+
+	return &Confirmation{tag: tag, done: done, exchange: exchange, key: key}, nil
+}
@@ -0,0 +1,59 @@
+package rmq
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// backoff computes the delay before the next connection attempt
+type backoff struct {
+	interval time.Duration // constant delay used when initial is zero
+	initial  time.Duration
+	max      time.Duration
+	jitter   bool
+	attempt  int
+}
+
+func newBackoff(opts *ConnectOpts) *backoff {
+	return &backoff{
+		interval: opts.ReconnectInterval,
+		initial:  opts.InitialBackoff,
+		max:      opts.MaxBackoff,
+		jitter:   opts.Jitter,
+	}
+}
+
+// next returns the delay to wait before the next attempt. The delay
+// doubles on every call starting at initial and is capped at max.
+// With jitter enabled a random delay between half and the full
+// delay is returned so that many clients don't retry in lockstep.
+func (b *backoff) next() time.Duration {
+	if b.initial <= 0 {
+		return b.interval
+	}
+
+	d := b.initial
+	for i := 0; i < b.attempt; i++ {
+		// stop doubling once capped or before overflowing
+		if (b.max > 0 && d >= b.max) || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if b.max > 0 && d > b.max {
+		d = b.max
+	}
+	b.attempt++
+
+	if b.jitter && d > 1 {
+		half := d / 2
+		d = half + time.Duration(rand.Int63n(int64(d-half)))
+	}
+	return d
+}
+
+// reset starts the backoff sequence over from initial
+func (b *backoff) reset() {
+	b.attempt = 0
+}
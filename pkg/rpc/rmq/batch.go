@@ -0,0 +1,184 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// BatchError is returned by PublishBatch when a message of the batch
+// could not be published or was not confirmed by the server
+type BatchError struct {
+	Index int // index of the first failed message in the batch
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("publishing #%d of batch: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+/*
+PublishBatch publishes msgs to the exchange using a single connection and
+channel, which is much faster than calling Publish for every message.
+
+When opts.Confirm or opts.Mandatory is true PublishBatch returns only after
+the server has acknowledged every message of the batch, ConfirmTimeout
+bounds the wait for the whole batch rather than for each message.
+
+If a message fails a *BatchError holding the index of the first failed
+message is returned. Messages before that index were published (and
+confirmed when waiting for confirmations), messages after it may or may not
+have been, so retrying the batch from Index delivers them at least once.
+
+ctx is the context object that can be used to stop publishing, the
+remaining messages of the batch are not published and waiting for their
+confirmations stops once it is done. Its trace context is injected into
+the headers of the messages.
+
+exchange is the name of exchange where the messages will be published
+
+key is the routing key used for routing the messages
+
+msgs are the messages to publish, in order
+
+opts is option for publishing the messages
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) PublishBatch(
+	ctx context.Context,
+	exchange, key string,
+	msgs []amqp.Publishing,
+	opts *PublishOpts,
+	connOpts *ConnectOpts) error {
+
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.PublishBatch(ctx, exchange, key, msgs, opts)
+	})
+}
+
+// PublishBatch publishes msgs to the exchange using the session channel,
+// see Client.PublishBatch
+func (s *Session) PublishBatch(
+	ctx context.Context,
+	exchange, key string,
+	msgs []amqp.Publishing,
+	opts *PublishOpts) (err error) {
+
+	defaultOpts := DefaultPublishOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	if s.metrics != nil {
+		defer func(start time.Time) {
+			s.onBatch(exchange, key, len(msgs), err, start)
+		}(time.Now())
+	}
+
+	if err = checkKey(key); err != nil {
+		return err
+	}
+	if err = checkTable("default headers", defaultOpts.DefaultHeaders); err != nil {
+		return err
+	}
+
+	// nothing is published if any message is invalid
+	for i, msg := range msgs {
+		if err := checkTable("headers", msg.Headers); err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+
+	tags := make([]uint64, 0, len(msgs))
+	dones := make([]<-chan confirmation, 0, len(msgs))
+
+	s.mu.Lock()
+	for i, msg := range msgs {
+		if err := ctx.Err(); err != nil {
+			s.mu.Unlock()
+			s.forgetAll(tags, dones)
+			return &BatchError{Index: i, Err: err}
+		}
+
+		tag, done, err := s.publish(s.inject(ctx, msg), exchange, key, defaultOpts)
+		if err != nil {
+			s.mu.Unlock()
+			s.forgetAll(tags, dones)
+			return &BatchError{Index: i, Err: err}
+		}
+		tags = append(tags, tag)
+		dones = append(dones, done)
+	}
+	s.mu.Unlock()
+
+	if !defaultOpts.Confirm && !defaultOpts.Mandatory {
+		return nil
+	}
+
+	var expired <-chan time.Time
+	if defaultOpts.ConfirmTimeout > 0 {
+		timer := time.NewTimer(defaultOpts.ConfirmTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for i, done := range dones {
+		var err error
+		select {
+		case c, ok := <-done:
+			err = c.err(ok)
+		case <-expired:
+			err = ErrConfirmTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		if err != nil {
+			s.forgetAll(tags[i:], dones[i:])
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// onBatch reports the publishings of a batch which failed or was
+// published with err, the messages after the failed one are not reported
+func (s *Session) onBatch(exchange, key string, n int, err error, start time.Time) {
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		n = batchErr.Index + 1
+	}
+
+	for i := 0; i < n; i++ {
+		var msgErr error
+		if batchErr != nil && i == batchErr.Index {
+			msgErr = batchErr.Err
+		}
+		s.onPublish(exchange, key, msgErr, start)
+	}
+}
+
+// forgetAll stops tracking the confirmations of publishings
+// nobody waits for anymore
+func (s *Session) forgetAll(tags []uint64, dones []<-chan confirmation) {
+	for i, tag := range tags {
+		if dones[i] != nil {
+			s.confirms.forget(tag)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+/*
+ConsumeBatchOpts ...
+
+Size is the largest number of deliveries handed to the handler at once. A
+batch is handled as soon as it is full.
+
+Linger is how long to wait for a batch to fill up, counted from its first
+delivery. Once it elapses the batch is handled with the deliveries received
+so far. Zero waits until the batch is full.
+*/
+type ConsumeBatchOpts struct {
+	Size   int           // default 100
+	Linger time.Duration // default 1s
+}
+
+// DefaultConsumeBatchOpts returns default batching options
+func DefaultConsumeBatchOpts() *ConsumeBatchOpts {
+	return &ConsumeBatchOpts{
+		Size:   100,
+		Linger: time.Second,
+	}
+}
+
+/*
+SubscribeBatch consumes from a queue like Subscribe with ListenIndefinitely,
+but hands the deliveries to handler in batches, e.g. for a sink which writes
+many rows at once much faster than one at a time. It returns nil once ctx is
+done.
+
+When handler returns nil the whole batch is acked. When it fails every
+delivery of the batch is nacked and requeued unless opts.RequeuePolicy says
+otherwise, and SubscribeBatch returns the error unless opts.ContinueOnError
+is set.
+
+Once ctx is done the server stops delivering and the deliveries received so
+far, which may be fewer than a full batch, are handled for at most
+opts.DrainTimeout. The handler then gets a context which is not done.
+
+With opts.Reconnect SubscribeBatch consumes again whenever the connection or
+channel closes, like SubscribeForever. The batch being collected is dropped
+then, the server requeues its deliveries as they were never acked.
+
+ctx is the context object that can be used to stop consuming
+
+queue is the name of the queue to consume from
+
+opts sets how deliveries are acknowledged, the consumer tag and the topology
+to declare. CorrelationID, Concurrency, PublishResponse, MaxRedeliveries and
+the quarantine have no effect on batches.
+
+batchOpts sets the size of the batches and how long to wait for a batch to
+fill up
+
+chanOpts sets the prefetch limits. The prefetch count must be at least the
+batch size, else batches never fill up. nil sets it to the batch size.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+handler is a function that will process the batches of messages
+*/
+func (c *Client) SubscribeBatch(
+	ctx context.Context,
+	queue string,
+	opts *SubscribeOpts,
+	batchOpts *ConsumeBatchOpts,
+	chanOpts *ChannelOpts,
+	connOpts *ConnectOpts,
+	handler func(ctx context.Context, msgs []amqp.Delivery) error,
+) error {
+
+	if opts == nil {
+		opts = DefaultSubscribeOpts()
+	}
+
+	defaultBatchOpts := DefaultConsumeBatchOpts()
+	if batchOpts != nil {
+		defaultBatchOpts = batchOpts
+	}
+	if defaultBatchOpts.Size < 1 {
+		return fmt.Errorf("batch size must be positive, got %d", defaultBatchOpts.Size)
+	}
+
+	if chanOpts == nil {
+		chanOpts = DefaultChannelOpts()
+		chanOpts.PrefetchCount = defaultBatchOpts.Size
+	}
+
+	consume := func(connOpts *ConnectOpts) error {
+		return c.consumeBatch(ctx, queue, opts, defaultBatchOpts, chanOpts, connOpts, handler)
+	}
+	if opts.Reconnect {
+		return c.resubscribe(ctx, queue, connOpts, consume)
+	}
+	return unwrapHandlerError(consume(connOpts))
+}
+
+// consumeBatch opens a session and hands the deliveries from queue to
+// handler in batches until ctx is done, the handler fails or the
+// deliveries stop because the connection closed
+func (c *Client) consumeBatch(
+	ctx context.Context,
+	queue string,
+	opts *SubscribeOpts,
+	batchOpts *ConsumeBatchOpts,
+	chanOpts *ChannelOpts,
+	connOpts *ConnectOpts,
+	handler func(ctx context.Context, msgs []amqp.Delivery) error,
+) error {
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ctx, sub, err := c.startConsumer(ctx, s, queue, opts, chanOpts)
+	if err != nil {
+		return err
+	}
+	defer sub.stop()
+	tag, msgs := sub.tag, sub.msgs
+
+	b := &batcher{
+		client:  c,
+		s:       s,
+		queue:   queue,
+		opts:    opts,
+		size:    batchOpts.Size,
+		handler: handler,
+	}
+
+	var timer *time.Timer
+	var linger <-chan time.Time
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				// unacked deliveries are requeued by the server
+				return sub.closed(opts)
+			}
+
+			s.onDeliver(queue)
+			b.msgs = append(b.msgs, msg)
+			if len(b.msgs) == 1 && batchOpts.Linger > 0 {
+				timer = time.NewTimer(batchOpts.Linger)
+				linger = timer.C
+			}
+			if len(b.msgs) < b.size {
+				continue
+			}
+
+			if timer != nil {
+				timer.Stop()
+				timer, linger = nil, nil
+			}
+			if err = b.flush(ctx); err != nil {
+				return err
+			}
+		case <-linger:
+			timer, linger = nil, nil
+			if err = b.flush(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return b.drain(tag, msgs, opts.DrainTimeout)
+		}
+	}
+}
+
+// batcher collects the deliveries of SubscribeBatch
+// and hands them to the handler
+type batcher struct {
+	client  *Client
+	s       *Session
+	queue   string
+	opts    *SubscribeOpts
+	size    int
+	handler func(ctx context.Context, msgs []amqp.Delivery) error
+	msgs    []amqp.Delivery
+}
+
+// flush runs the handler on the collected deliveries and acks or nacks
+// them. It returns the handler error unless opts.ContinueOnError is set,
+// wrapped so that it is not mistaken for a connection failure.
+func (b *batcher) flush(ctx context.Context) error {
+	if len(b.msgs) == 0 {
+		return nil
+	}
+
+	// the handler may keep the slice, start a new one
+	msgs := b.msgs
+	b.msgs = make([]amqp.Delivery, 0, b.size)
+
+	ctx, cancel := context.WithCancel(ctx)
+	err := b.handler(ctx, msgs)
+	cancel()
+
+	if err != nil {
+		if !b.opts.AutoAck {
+			for _, msg := range msgs {
+				requeue := b.opts.requeue(msg, err)
+				msg.Nack(false, requeue)
+				b.s.onNack(b.queue, requeue)
+			}
+		}
+		if b.opts.ContinueOnError {
+			b.client.logf("Batch handler failed: %s\n", err.Error())
+			return nil
+		}
+		return &handlerError{err}
+	}
+
+	if !b.opts.AutoAck {
+		// acks every delivery of the channel up to the last one
+		msgs[len(msgs)-1].Ack(true)
+		for range msgs {
+			b.s.onAck(b.queue)
+		}
+	}
+	return nil
+}
+
+// drain cancels the consumer and handles the deliveries received until the
+// delivery channel closes, for at most timeout. A zero timeout waits
+// indefinitely. Deliveries left unhandled are requeued by the server.
+func (b *batcher) drain(tag string, msgs <-chan amqp.Delivery, timeout time.Duration) error {
+	// ctx of the subscription is done, the last batches get their own
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	go func() {
+		if err := b.s.ch.Cancel(tag, false); err != nil {
+			b.client.logf("Cancelling consumer [%s] failed: %s\n", tag, err.Error())
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return b.logErr(b.flush(ctx))
+			}
+
+			b.s.onDeliver(b.queue)
+			b.msgs = append(b.msgs, msg)
+			if len(b.msgs) < b.size {
+				continue
+			}
+			if err := b.flush(ctx); err != nil {
+				return b.logErr(err)
+			}
+		case <-ctx.Done():
+			b.client.logf("Timed out draining deliveries of consumer [%s]\n", tag)
+			return nil
+		}
+	}
+}
+
+// logErr logs err of a batch handled while draining, SubscribeBatch
+// returns nil once ctx is done like Subscribe
+func (b *batcher) logErr(err error) error {
+	if err != nil {
+		b.client.logf("Batch handler failed: %s\n", err.Error())
+	}
+	return nil
+}
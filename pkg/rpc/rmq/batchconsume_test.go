@@ -0,0 +1,117 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// TestSubscribeBatchReconnect drops the connection of SubscribeBatch with
+// opts.Reconnect between two batches and checks it consumes again
+func TestSubscribeBatchReconnect(t *testing.T) {
+	c, connOpts := stubClient(t)
+	c.SetLogger(NopLogger())
+	broker := newStubBroker()
+	connOpts.Config = broker.config()
+	connOpts.ReconnectInterval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.QueueDeclare("rows", nil, connOpts); err != nil {
+		t.Fatal(err)
+	}
+	publish := func(from, to int) {
+		for i := from; i < to; i++ {
+			msg := amqp.Publishing{Body: []byte(fmt.Sprintf("row %d", i))}
+			if err := c.Publish(msg, "", "rows", nil, connOpts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	publish(0, 3)
+
+	opts := DefaultSubscribeOpts()
+	opts.Reconnect = true
+	var starts int
+	opts.OnStart = func(tag string) { starts++ }
+
+	batches := make(chan []amqp.Delivery)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SubscribeBatch(ctx, "rows", opts, &ConsumeBatchOpts{Size: 3}, nil, connOpts,
+			func(ctx context.Context, msgs []amqp.Delivery) error {
+				batches <- msgs
+				return nil
+			})
+	}()
+
+	next := func() []amqp.Delivery {
+		select {
+		case msgs := <-batches:
+			return msgs
+		case <-ctx.Done():
+			t.Fatal("no batch handed to the handler")
+			return nil
+		}
+	}
+
+	if msgs := next(); len(msgs) != 3 {
+		t.Fatalf("first batch has %d deliveries, want 3", len(msgs))
+	}
+
+	broker.disconnect()
+	publish(3, 6)
+	msgs := next()
+	if len(msgs) != 3 || string(msgs[0].Body) != "row 3" {
+		t.Fatalf("batch after reconnecting = %d deliveries starting with %q, want rows 3 to 5",
+			len(msgs), msgs[0].Body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("SubscribeBatch = %v, want nil once ctx is done", err)
+	}
+	if starts != 2 {
+		t.Errorf("consumer started %d times, want once more after reconnecting", starts)
+	}
+}
+
+// TestSubscribeBatchReconnectHandlerError checks that a failing handler
+// ends SubscribeBatch instead of reconnecting
+func TestSubscribeBatchReconnectHandlerError(t *testing.T) {
+	c, connOpts := stubClient(t)
+	c.SetLogger(NopLogger())
+	broker := newStubBroker()
+	connOpts.Config = broker.config()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.QueueDeclare("rows", nil, connOpts); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(amqp.Publishing{Body: []byte("row")}, "", "rows", nil, connOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultSubscribeOpts()
+	opts.Reconnect = true
+	opts.RequeuePolicy = func(amqp.Delivery, error) bool { return false }
+	sinkDown := errors.New("sink down")
+
+	err := c.SubscribeBatch(ctx, "rows", opts, &ConsumeBatchOpts{Size: 1}, nil, connOpts,
+		func(ctx context.Context, msgs []amqp.Delivery) error {
+			return sinkDown
+		})
+	if err != sinkDown {
+		t.Errorf("SubscribeBatch = %v, want the handler error", err)
+	}
+	if _, nacks := broker.settled(); nacks != 1 {
+		t.Errorf("broker got %d nacks, want the failed batch nacked", nacks)
+	}
+}
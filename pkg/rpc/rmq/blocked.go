@@ -0,0 +1,65 @@
+package rmq
+
+import (
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// blockedListeners fans the connection.blocked notifications
+// of every connection of a client out to the listeners
+type blockedListeners struct {
+	mu    sync.Mutex
+	chans []chan amqp.Blocking
+}
+
+func (b *blockedListeners) listen(ch chan amqp.Blocking) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.chans = append(b.chans, ch)
+}
+
+// watch forwards the notifications of conn if anybody listens
+func (b *blockedListeners) watch(conn *amqp.Connection) {
+	b.mu.Lock()
+	listening := len(b.chans) > 0
+	b.mu.Unlock()
+
+	if !listening {
+		return
+	}
+
+	go b.forward(conn.NotifyBlocked(make(chan amqp.Blocking, 1)))
+}
+
+func (b *blockedListeners) forward(events <-chan amqp.Blocking) {
+	for event := range events {
+		b.mu.Lock()
+		for _, ch := range b.chans {
+			// never block the connection, which waits on this goroutine
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+/*
+NotifyBlocked returns a chan which receives an event with Active set when the
+server blocks a connection of the client from publishing because of a memory
+or disk alarm, and an event with Active unset once the alarm cleared.
+Publishing hangs while a connection is blocked, so callers can use the events
+to pause publishing and raise an alert.
+
+Connections dialed before the call are not watched, so it should be called
+right after creating the client. The chan is never closed and has to be read
+continuously, events are dropped while it is full.
+*/
+func (c *Client) NotifyBlocked() <-chan amqp.Blocking {
+	ch := make(chan amqp.Blocking, 16)
+	c.blocked.listen(ch)
+	return ch
+}
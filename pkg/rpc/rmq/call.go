@@ -0,0 +1,121 @@
+package rmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// newCorrelationID returns a random ID to correlate a reply with its request
+func newCorrelationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+/*
+Call publishes req as a request and waits for the correlated reply, i.e. the
+client side of the RPC pattern served by Subscribe.
+
+A server named exclusive queue is declared to receive the reply and its name
+is set as ReplyTo of the request. Unless the request already carries one, a
+random CorrelationId is generated. The first message on the reply queue with
+the same CorrelationId is returned, other messages are discarded.
+
+The responder has to publish the reply with the CorrelationId of the request
+to the default exchange using ReplyTo as routing key.
+
+ctx is the context object that can be used to give up waiting for the reply
+
+exchange is the name of exchange where the request will be published
+
+key is the routing key used for routing the request
+
+req is the request message
+
+timeout bounds the whole call, including connecting, 0 means no bound
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) Call(
+	ctx context.Context,
+	exchange, key string,
+	req amqp.Publishing,
+	timeout time.Duration,
+	connOpts *ConnectOpts) (amqp.Delivery, error) {
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx, cancel := withTimeout(ctx, connOpts)
+	defer cancel()
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return amqp.Delivery{}, err
+	}
+	defer s.Close()
+
+	q, err := s.QueueDeclare("", &DeclareQueueOpts{
+		Durable:    false,
+		AutoDelete: true,
+		Exclusive:  true,
+	})
+	if err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	s.taint()
+	replies, err := s.ch.Consume(
+		q.Name,
+		"",
+		true, // replies are not redelivered, ack on delivery
+		true,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return amqp.Delivery{}, fmt.Errorf("consume replies from queue [%s]: %w", q.Name, err)
+	}
+
+	if req.CorrelationId == "" {
+		req.CorrelationId, err = newCorrelationID()
+		if err != nil {
+			return amqp.Delivery{}, err
+		}
+	}
+	req.ReplyTo = q.Name
+
+	err = s.PublishContext(ctx, req, exchange, key, nil)
+	if err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	for {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				return amqp.Delivery{}, errConnectionClosed
+			}
+			if msg.CorrelationId == req.CorrelationId {
+				return msg, nil
+			}
+			c.logf("Discarding reply as "+
+				"correlationIDs don't match. Got: [%s] Expected: [%s]\n",
+				msg.CorrelationId, req.CorrelationId)
+		case <-ctx.Done():
+			return amqp.Delivery{}, fmt.Errorf("waiting for reply to [%s]: %w",
+				req.CorrelationId, ctx.Err())
+		}
+	}
+}
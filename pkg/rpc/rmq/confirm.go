@@ -0,0 +1,236 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrPublishNacked is returned when the server negatively
+	// acknowledges a publishing sent in confirm mode
+	ErrPublishNacked = errors.New("publishing nacked by server")
+
+	// ErrConfirmTimeout is returned when the confirmation for a
+	// publishing did not arrive within PublishOpts.ConfirmTimeout
+	ErrConfirmTimeout = errors.New("timed out waiting for publish confirmation")
+
+	// ErrConfirmLost is returned when the channel closed before
+	// the publishing was confirmed by the server
+	ErrConfirmLost = errors.New("channel closed before publishing was confirmed")
+)
+
+// ReturnError is returned when the server returned a mandatory
+// publishing because it could not be routed to any queue
+type ReturnError struct {
+	ReplyCode  uint16
+	ReplyText  string
+	Exchange   string
+	RoutingKey string
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("publishing returned by server: %d %s (exchange [%s], key [%s])",
+		e.ReplyCode, e.ReplyText, e.Exchange, e.RoutingKey)
+}
+
+// confirmation is the outcome of a publishing in confirm mode
+type confirmation struct {
+	ack      bool
+	returned *amqp.Return // set if the server returned the publishing
+}
+
+// confirmTracker matches the confirmations of a channel in confirm
+// mode with the publishings waiting on them. Delivery tags start at 1
+// and are incremented by the server for every publishing on the channel.
+//
+// The server sends basic.return of an unroutable mandatory publishing right
+// before its basic.ack. Both chans are unbuffered, so the return has been
+// received by the time the ack is and is matched with the ack's tag.
+type confirmTracker struct {
+	mu      sync.Mutex
+	nextTag uint64
+	waiting map[uint64]chan confirmation
+	closed  bool
+
+	onReturn func(amqp.Return) // nil unless set with Session.OnReturn
+
+	// publishings not confirmed yet, only kept while onLost is set
+	pending map[uint64]Unconfirmed
+	onLost  func([]Unconfirmed)
+}
+
+func newConfirmTracker(
+	confirms <-chan amqp.Confirmation,
+	returns <-chan amqp.Return,
+	onReturn func(amqp.Return),
+	onLost func([]Unconfirmed)) *confirmTracker {
+
+	t := &confirmTracker{
+		waiting:  make(map[uint64]chan confirmation),
+		onReturn: onReturn,
+		pending:  make(map[uint64]Unconfirmed),
+		onLost:   onLost,
+	}
+	go t.run(confirms, returns)
+	return t
+}
+
+// expect reserves the delivery tag of the next publishing. When wait is
+// true the returned chan receives the confirmation of the publishing and
+// is closed without a value if the channel closed before that.
+// Must be called right before publishing, with publishing serialized.
+func (t *confirmTracker) expect(wait bool, exchange, key string, msg amqp.Publishing) (uint64, <-chan confirmation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextTag++
+	if t.onLost != nil && !t.closed {
+		t.pending[t.nextTag] = Unconfirmed{
+			DeliveryTag: t.nextTag,
+			Exchange:    exchange,
+			Key:         key,
+			Msg:         msg,
+		}
+	}
+	if !wait {
+		return t.nextTag, nil
+	}
+
+	done := make(chan confirmation, 1)
+	if t.closed {
+		close(done)
+		return t.nextTag, done
+	}
+	t.waiting[t.nextTag] = done
+	return t.nextTag, done
+}
+
+// forget stops tracking a publishing nobody waits for anymore
+func (t *confirmTracker) forget(tag uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.waiting, tag)
+}
+
+func (t *confirmTracker) run(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	var returned *amqp.Return
+	for confirms != nil {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			returned = &r
+			t.returned(r)
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+
+			t.mu.Lock()
+			if done, ok := t.waiting[c.DeliveryTag]; ok {
+				done <- confirmation{ack: c.Ack, returned: returned}
+				delete(t.waiting, c.DeliveryTag)
+			}
+			delete(t.pending, c.DeliveryTag)
+			t.mu.Unlock()
+			returned = nil
+		}
+	}
+
+	// channel closed, nothing pending will be confirmed anymore
+	t.mu.Lock()
+	t.closed = true
+	for tag, done := range t.waiting {
+		close(done)
+		delete(t.waiting, tag)
+	}
+	lost := t.unconfirmed()
+	onLost := t.onLost
+	t.mu.Unlock()
+
+	if len(lost) > 0 && onLost != nil {
+		onLost(lost)
+	}
+}
+
+// waitConfirm blocks until the confirmation arrives on done, timeout
+// elapses or ctx is done, a zero timeout waits until the channel is closed
+func (t *confirmTracker) waitConfirm(
+	ctx context.Context,
+	tag uint64,
+	done <-chan confirmation,
+	timeout time.Duration) error {
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case c, ok := <-done:
+		return c.err(ok)
+	case <-expired:
+		t.forget(tag)
+		return ErrConfirmTimeout
+	case <-ctx.Done():
+		t.forget(tag)
+		return ctx.Err()
+	}
+}
+
+// err returns the error for a confirmation received from a done chan,
+// ok is false if the chan was closed without a confirmation
+func (c confirmation) err(ok bool) error {
+	if !ok {
+		return ErrConfirmLost
+	}
+	if c.returned != nil {
+		return &ReturnError{
+			ReplyCode:  c.returned.ReplyCode,
+			ReplyText:  c.returned.ReplyText,
+			Exchange:   c.returned.Exchange,
+			RoutingKey: c.returned.RoutingKey,
+		}
+	}
+	if !c.ack {
+		return ErrPublishNacked
+	}
+	return nil
+}
+
+// confirmMode puts the session channel into confirm mode on first use.
+// Must be called with s.mu held.
+func (s *Session) confirmMode() (*confirmTracker, error) {
+	if s.confirms != nil {
+		return s.confirms, nil
+	}
+	// the server closes the channel on confirm.select in transaction mode
+	if s.tx {
+		return nil, ErrConfirmMode
+	}
+
+	s.taint()
+	if err := s.ch.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	// both chans must be unbuffered, see confirmTracker
+	s.confirms = newConfirmTracker(
+		s.ch.NotifyPublish(make(chan amqp.Confirmation)),
+		s.ch.NotifyReturn(make(chan amqp.Return)),
+		s.onReturn,
+		s.onLost,
+	)
+	return s.confirms, nil
+}
@@ -0,0 +1,146 @@
+package rmq
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/streadway/amqp"
+)
+
+// connListeners fans the notifications of the connections of a client out
+// to the sessions listening. streadway keeps a listener until its
+// connection closes and blocks the connection while a listener doesn't
+// receive, so sessions sharing a pooled connection register with this
+// instead. Their chans never block the connection and are dropped when
+// the sessions are closed.
+type connListeners struct {
+	mu    sync.Mutex
+	conns map[*amqp.Connection]*connListener
+}
+
+// connListener holds the chans of the sessions listening on one connection
+type connListener struct {
+	closes  map[chan *amqp.Error]*Session
+	blocked map[chan amqp.Blocking]*Session
+}
+
+// notifyClose registers ch to receive the close error of the connection
+// of s, it is closed right away if s is closed already
+func (l *connListeners) notifyClose(s *Session, ch chan *amqp.Error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cl := l.watch(s.conn)
+	if atomic.LoadInt32(&s.closed) == 1 {
+		close(ch)
+		return
+	}
+	cl.closes[ch] = s
+}
+
+// notifyBlocked registers ch to receive the connection.blocked events of
+// the connection of s, it is closed right away if s is closed already
+func (l *connListeners) notifyBlocked(s *Session, ch chan amqp.Blocking) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cl := l.watch(s.conn)
+	if atomic.LoadInt32(&s.closed) == 1 {
+		close(ch)
+		return
+	}
+	cl.blocked[ch] = s
+}
+
+// watch returns the listener of conn, listening on conn
+// itself the first time. Listening on a closed connection ends right
+// away. l.mu must be held.
+func (l *connListeners) watch(conn *amqp.Connection) *connListener {
+	if cl := l.conns[conn]; cl != nil {
+		return cl
+	}
+
+	cl := &connListener{
+		closes:  map[chan *amqp.Error]*Session{},
+		blocked: map[chan amqp.Blocking]*Session{},
+	}
+	if l.conns == nil {
+		l.conns = map[*amqp.Connection]*connListener{}
+	}
+	l.conns[conn] = cl
+
+	go l.forward(conn, cl,
+		conn.NotifyClose(make(chan *amqp.Error, 1)),
+		conn.NotifyBlocked(make(chan amqp.Blocking, 1)))
+	return cl
+}
+
+// forward hands the blocked events of conn to the listeners until conn
+// closes, then hands them the close error and drops them
+func (l *connListeners) forward(
+	conn *amqp.Connection,
+	cl *connListener,
+	closes <-chan *amqp.Error,
+	blocked <-chan amqp.Blocking) {
+
+	var err *amqp.Error
+	for done := false; !done; {
+		select {
+		case event, ok := <-blocked:
+			if !ok {
+				blocked = nil // closed right after closes
+				continue
+			}
+			l.mu.Lock()
+			for ch := range cl.blocked {
+				// never block the connection, which waits on this goroutine
+				select {
+				case ch <- event:
+				default:
+				}
+			}
+			l.mu.Unlock()
+		case err = <-closes:
+			// nil and closed without a value on a graceful close
+			done = true
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.conns, conn)
+	for ch := range cl.closes {
+		if err != nil {
+			ch <- err // buffered and sent to once, never blocks
+		}
+		close(ch)
+	}
+	for ch := range cl.blocked {
+		close(ch)
+	}
+	cl.closes, cl.blocked = nil, nil
+}
+
+// forget closes the chans s listens on, once s is closed
+func (l *connListeners) forget(s *Session) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cl := l.conns[s.conn]
+	if cl == nil {
+		return
+	}
+	for ch, owner := range cl.closes {
+		if owner == s {
+			delete(cl.closes, ch)
+			close(ch)
+		}
+	}
+	for ch, owner := range cl.blocked {
+		if owner == s {
+			delete(cl.blocked, ch)
+			close(ch)
+		}
+	}
+}
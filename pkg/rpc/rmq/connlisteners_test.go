@@ -0,0 +1,132 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// closedWithin reports whether ch is closed within a second, failing if it
+// receives a value instead
+func closedWithin[T any](t *testing.T, ch <-chan T) bool {
+	t.Helper()
+
+	select {
+	case v, ok := <-ch:
+		if ok {
+			t.Errorf("chan received %v, want it closed without a value", v)
+		}
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// TestSessionNotifyClose checks that the close listeners of sessions on a
+// pooled connection are dropped with the session that registered them
+func TestSessionNotifyClose(t *testing.T) {
+	_, connOpts := stubClient(t)
+	c := &Client{addr: stubAddr, pool: newConnPool(&PoolOpts{MaxConns: 1, MaxChannelsPerConn: 4})}
+	c.SetLogger(NopLogger())
+	defer c.Close()
+	ctx := context.Background()
+
+	closed, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.conn != open.conn {
+		t.Fatal("sessions don't share the pooled connection")
+	}
+
+	closedNotified := closed.NotifyClose()
+	openNotified := open.NotifyClose()
+
+	closed.Close()
+	if !closedWithin(t, closedNotified) {
+		t.Fatal("NotifyClose chan not closed with its session")
+	}
+	if after := closed.NotifyClose(); !closedWithin(t, after) {
+		t.Error("NotifyClose after Close returned an open chan")
+	}
+
+	c.listeners.mu.Lock()
+	n := len(c.listeners.conns[open.conn].closes)
+	c.listeners.mu.Unlock()
+	if n != 1 {
+		t.Errorf("connection has %d close listeners, want the one of the open session", n)
+	}
+
+	select {
+	case <-openNotified:
+		t.Fatal("NotifyClose chan of the open session fired while its connection is open")
+	default:
+	}
+
+	open.conn.Close()
+	if !closedWithin(t, openNotified) {
+		t.Fatal("NotifyClose chan not closed with the connection")
+	}
+	c.listeners.mu.Lock()
+	n = len(c.listeners.conns)
+	c.listeners.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d connections still watched after they closed", n)
+	}
+	open.Close()
+}
+
+// TestConnListenersBlocked checks that a session not reading its
+// NotifyBlocked chan doesn't keep the connection from delivering events
+func TestConnListenersBlocked(t *testing.T) {
+	conn := new(amqp.Connection) // only used as key
+	cl := &connListener{
+		closes:  map[chan *amqp.Error]*Session{},
+		blocked: map[chan amqp.Blocking]*Session{},
+	}
+	l := &connListeners{conns: map[*amqp.Connection]*connListener{conn: cl}}
+
+	idle, reading := &Session{conn: conn}, &Session{conn: conn}
+	idleEvents := make(chan amqp.Blocking, 1)
+	readEvents := make(chan amqp.Blocking, 1)
+	l.notifyBlocked(idle, idleEvents)
+	l.notifyBlocked(reading, readEvents)
+
+	// unbuffered like a connection waiting on the send
+	closes := make(chan *amqp.Error)
+	blocked := make(chan amqp.Blocking)
+	go l.forward(conn, cl, closes, blocked)
+
+	for i := 0; i < 10; i++ {
+		event := amqp.Blocking{Active: i%2 == 0, Reason: "low on memory"}
+		select {
+		case blocked <- event:
+		case <-time.After(time.Second):
+			t.Fatalf("event #%d not received while a listener is full", i)
+		}
+		if got := <-readEvents; got != event {
+			t.Errorf("event #%d = %+v, want %+v", i, got, event)
+		}
+	}
+
+	l.forget(idle)
+	if <-idleEvents; !closedWithin(t, idleEvents) {
+		t.Fatal("NotifyBlocked chan not closed with its session")
+	}
+
+	close(closes)
+	if !closedWithin(t, readEvents) {
+		t.Fatal("NotifyBlocked chan not closed with the connection")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.conns) != 0 {
+		t.Errorf("%d connections still watched after they closed", len(l.conns))
+	}
+}
@@ -0,0 +1,519 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrUnknownConsumer is returned by CancelConsumer when no
+// subscription of the client consumes with the tag
+var ErrUnknownConsumer = errors.New("no consumer with this tag")
+
+// errConsumerTagInUse is returned by consume when another
+// subscription of the client consumes with the same tag
+var errConsumerTagInUse = errors.New("consumer tag already in use")
+
+// errConnectionClosed is returned by consume when the delivery
+// channel closed because the connection or channel went away
+var errConnectionClosed = errors.New("connection closed/interrupted")
+
+// ErrConsumerCancelled is returned by Subscribe when the server cancelled
+// the consumer, e.g. because its queue was deleted
+var ErrConsumerCancelled = errors.New("consumer cancelled by server")
+
+// handlerError wraps errors returned by the handler so that
+// they are not mistaken for connection failures
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+// unwrapHandlerError returns the error as returned by the handler
+func unwrapHandlerError(err error) error {
+	if he, ok := err.(*handlerError); ok {
+		return he.err
+	}
+	return err
+}
+
+/*
+Handler processes a delivery like the handler of Subscribe, see
+SubscribeHandler. ctx is derived from the context of the subscription, it
+carries the trace context extracted from the delivery and is cancelled once
+the handler returns or the subscription stops.
+*/
+type Handler func(ctx context.Context, msg amqp.Delivery) (amqp.Publishing, error)
+
+// withContext turns a handler of Subscribe into a Handler
+func withContext(handler func(amqp.Delivery) (amqp.Publishing, error)) Handler {
+	return func(_ context.Context, msg amqp.Delivery) (amqp.Publishing, error) {
+		return handler(msg)
+	}
+}
+
+// reply returns resp with the correlation ID of the request msg
+// unless the handler set one
+func reply(msg amqp.Delivery, resp amqp.Publishing) amqp.Publishing {
+	if resp.CorrelationId == "" {
+		resp.CorrelationId = msg.CorrelationId
+	}
+	return resp
+}
+
+// publishReply publishes the response of the handler to the ReplyTo queue
+// of msg. It goes through publish like any other publishing of the session,
+// so that delivery tags stay in step when the channel is in confirm mode.
+// The reply is not confirmed.
+func (s *Session) publishReply(ctx context.Context, msg amqp.Delivery, resp amqp.Publishing) (err error) {
+	if s.metrics != nil {
+		defer func(start time.Time) {
+			s.onPublish("", msg.ReplyTo, err, start)
+		}(time.Now())
+	}
+
+	out := s.inject(ctx, reply(msg, resp))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// replies are routed by queue name
+	_, _, err = s.publish(out, "", msg.ReplyTo, DefaultPublishOpts())
+	return err
+}
+
+// consumerSeq makes the consumer tags generated by this process unique
+var consumerSeq uint64
+
+func newConsumerTag() string {
+	return fmt.Sprintf("ctag-%s-%d",
+		filepath.Base(os.Args[0]),
+		atomic.AddUint64(&consumerSeq, 1))
+}
+
+// consumerRegistry tracks the running subscriptions of a client by consumer
+// tag. Consumer tags are scoped to the channel, so a consumer can only be
+// cancelled by the subscription which owns the channel.
+type consumerRegistry struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	closed  bool // set by cancelAll, no subscriptions are added after it
+}
+
+func (r *consumerRegistry) add(tag string, cancel context.CancelFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClientClosed
+	}
+	if _, ok := r.cancels[tag]; ok {
+		return fmt.Errorf("%w: [%s]", errConsumerTagInUse, tag)
+	}
+	if r.cancels == nil {
+		r.cancels = make(map[string]context.CancelFunc)
+	}
+	r.cancels[tag] = cancel
+	return nil
+}
+
+func (r *consumerRegistry) remove(tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.cancels, tag)
+}
+
+func (r *consumerRegistry) cancel(tag string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, ok := r.cancels[tag]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (r *consumerRegistry) cancelAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for _, cancel := range r.cancels {
+		cancel()
+	}
+}
+
+/*
+Subscribe consumes from queue using the session channel, see Client.Subscribe.
+A session can not be reopened, so opts.Reconnect has no effect. Use it for
+queues only the connection of the session can access, e.g. exclusive queues.
+*/
+func (s *Session) Subscribe(
+	ctx context.Context,
+	queue string,
+	opts *SubscribeOpts,
+	chanOpts *ChannelOpts,
+	handler func(amqp.Delivery) (amqp.Publishing, error),
+) error {
+
+	if opts == nil {
+		opts = DefaultSubscribeOpts()
+	}
+
+	err := s.client.consumeOn(ctx, s, queue, opts, chanOpts, withContext(handler))
+	return unwrapHandlerError(err)
+}
+
+/*
+CancelConsumer stops the subscription of this client consuming with tag, as
+if the context of Subscribe was done: the server stops delivering, in-flight
+messages are handled and Subscribe returns nil. It returns without waiting
+for Subscribe to return.
+
+tag is the ConsumerTag of the subscription, or the generated tag passed to
+SubscribeOpts.OnStart
+
+connOpts provides connection options, only its Logger is used, as the
+subscription cancels the consumer on its own channel and no connection is
+opened.
+
+Only subscriptions started by this client can be cancelled, as the server
+scopes consumer tags to the channel. ErrUnknownConsumer is returned if none
+consumes with tag.
+*/
+func (c *Client) CancelConsumer(tag string, connOpts *ConnectOpts) error {
+	if !c.consumers.cancel(tag) {
+		return fmt.Errorf("cancel consumer [%s]: %w", tag, ErrUnknownConsumer)
+	}
+	c.loggerFor(connOpts).Printf("Cancelling consumer [%s]\n", tag)
+	return nil
+}
+
+// consume opens a session, starts consuming from queue and hands the
+// deliveries to opts.Concurrency workers until ctx is done, a worker
+// fails or the deliveries stop because the connection closed
+func (c *Client) consume(
+	ctx context.Context,
+	queue string,
+	opts *SubscribeOpts,
+	chanOpts *ChannelOpts,
+	connOpts *ConnectOpts,
+	handler Handler,
+) error {
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return c.consumeOn(ctx, s, queue, opts, chanOpts, handler)
+}
+
+// consumer is a consumer started by startConsumer
+type consumer struct {
+	client  *Client
+	tag     string
+	msgs    <-chan amqp.Delivery
+	closes  chan *amqp.Error // why the channel closed, if it closed abnormally
+	cancels chan string      // the consumer if the server cancelled it
+	cancel  context.CancelFunc
+}
+
+// startConsumer declares opts.Topology, sets the prefetch limits of
+// chanOpts and starts consuming from queue on the channel of s, as done
+// by Subscribe and SubscribeBatch. The returned ctx is cancelled by
+// CancelConsumer with the tag of the consumer, which must be stopped
+// once consuming ended.
+func (c *Client) startConsumer(
+	ctx context.Context,
+	s *Session,
+	queue string,
+	opts *SubscribeOpts,
+	chanOpts *ChannelOpts,
+) (context.Context, *consumer, error) {
+
+	if opts.Topology != nil {
+		if err := s.DeclareTopology(ctx, opts.Topology); err != nil {
+			return ctx, nil, err
+		}
+	}
+
+	if err := s.Qos(chanOpts); err != nil {
+		return ctx, nil, err
+	}
+
+	sub := &consumer{
+		client:  c,
+		tag:     opts.ConsumerTag,
+		closes:  s.ch.NotifyClose(make(chan *amqp.Error, 1)),
+		cancels: s.ch.NotifyCancel(make(chan string, 1)),
+	}
+	if sub.tag == "" {
+		sub.tag = newConsumerTag()
+	}
+
+	// CancelConsumer cancels ctx to stop consuming
+	ctx, sub.cancel = context.WithCancel(ctx)
+	if err := c.consumers.add(sub.tag, sub.cancel); err != nil {
+		sub.cancel()
+		return ctx, nil, err
+	}
+
+	msgs, err := s.ch.Consume(
+		queue,
+		sub.tag,
+		opts.AutoAck,
+		opts.ExclusiveConsumer,
+		opts.NoLocal,
+		false,
+		opts.consumeArgs(),
+	)
+	if err != nil {
+		sub.stop()
+		return ctx, nil, fmt.Errorf("consume from queue [%s]: %w", queue, err)
+	}
+	sub.msgs = msgs
+
+	if opts.OnStart != nil {
+		opts.OnStart(sub.tag)
+	}
+	return ctx, sub, nil
+}
+
+// stop removes the consumer from the registry of CancelConsumer and
+// cancels its ctx
+func (sub *consumer) stop() {
+	sub.client.consumers.remove(sub.tag)
+	sub.cancel()
+}
+
+// closed returns why the deliveries of the consumer stopped, see
+// SubscribeOpts.deliveriesClosed
+func (sub *consumer) closed(opts *SubscribeOpts) error {
+	return opts.deliveriesClosed(sub.tag, sub.cancels, sub.closes)
+}
+
+// consumeOn is like consume but uses the channel of s
+func (c *Client) consumeOn(
+	ctx context.Context,
+	s *Session,
+	queue string,
+	opts *SubscribeOpts,
+	chanOpts *ChannelOpts,
+	handler Handler,
+) error {
+
+	ctx, sub, err := c.startConsumer(ctx, s, queue, opts, chanOpts)
+	if err != nil {
+		return err
+	}
+	defer sub.stop()
+	tag, msgs := sub.tag, sub.msgs
+
+	// A single message is handled unless listening indefinitely
+	workers := opts.Concurrency
+	if workers < 1 || !opts.ListenIndefinitely {
+		workers = 1
+	}
+
+	stop := make(chan struct{})
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.work(ctx, s, queue, msgs, stop, opts, handler)
+		}()
+	}
+
+	select {
+	case err = <-errs:
+		// The first worker to stop decides the outcome, the others are
+		// stopped once they are done with the message at hand.
+		close(stop)
+		wg.Wait()
+
+		if err == errConnectionClosed {
+			err = sub.closed(opts)
+		}
+		return err
+	case <-ctx.Done():
+		c.drain(s, tag, errs, workers, stop, opts.DrainTimeout)
+		return nil
+	}
+}
+
+// drain cancels the consumer so that the server stops delivering and lets
+// the workers handle the deliveries already received until the delivery
+// channel closes, for at most timeout. A zero timeout waits indefinitely.
+func (c *Client) drain(
+	s *Session,
+	tag string,
+	errs <-chan error,
+	workers int,
+	stop chan struct{},
+	timeout time.Duration,
+) {
+
+	defer close(stop)
+
+	// The delivery channel is closed once the server confirmed the
+	// cancel and all buffered deliveries have been handed out, or
+	// as soon as the channel closes if the cancel fails.
+	go func() {
+		if err := s.ch.Cancel(tag, false); err != nil {
+			c.logf("Cancelling consumer [%s] failed: %s\n", tag, err.Error())
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for i := 0; i < workers; i++ {
+		select {
+		case <-errs:
+		case <-expired:
+			c.logf("Timed out draining deliveries of consumer [%s]\n", tag)
+			return
+		}
+	}
+}
+
+// work handles deliveries one at a time until msgs closes or stop is
+// closed, each delivery is acked or nacked by the worker which handled it
+func (c *Client) work(
+	ctx context.Context,
+	s *Session,
+	queue string,
+	msgs <-chan amqp.Delivery,
+	stop <-chan struct{},
+	opts *SubscribeOpts,
+	handler Handler,
+) error {
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return errConnectionClosed
+			}
+
+			handled, err := c.handle(ctx, s, queue, msg, opts, handler)
+			if err != nil {
+				return err
+			}
+
+			// Listen indefinitely
+			// if requested
+			if handled && !opts.ListenIndefinitely {
+				return nil
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// handle runs handler on msg, acknowledges msg and publishes the response
+// if requested. It reports whether msg was handled or skipped.
+func (c *Client) handle(
+	ctx context.Context,
+	s *Session,
+	queue string,
+	msg amqp.Delivery,
+	opts *SubscribeOpts,
+	handler Handler,
+) (bool, error) {
+
+	s.onDeliver(queue)
+
+	if len(msg.Body) == 0 {
+		c.logf("Received empty message. Ignoring...\n")
+		return false, nil
+	}
+
+	//log.Printf("Received message: %s\n\n\n%v\n", string(msg.Body), msg)
+
+	if opts.CorrelationID != "" && msg.CorrelationId != opts.CorrelationID {
+		c.logf("Re-queuing message as "+
+			"correlationIDs don't match. Got: [%s] Expected: [%s]\n",
+			msg.CorrelationId, opts.CorrelationID)
+		if !opts.AutoAck {
+			msg.Nack(false, true)
+			s.onNack(queue, true)
+		}
+		return false, nil
+	}
+
+	// a copy republished by redeliver is handled like the original
+	msg = withOriginalRouting(msg, queue)
+
+	// call handler to process message
+	ctx, cancel := context.WithCancel(ctx)
+	ctx, end := s.startSpan(ctx, queue, msg)
+	resp, err := c.call(ctx, msg, opts, handler)
+	end(err)
+	cancel()
+	if err != nil {
+		// requeue if error happened while processing
+		// request msg unless the policy says otherwise
+		if !opts.AutoAck {
+			requeue := opts.requeue(msg, err)
+			if requeue && opts.MaxRedeliveries > 0 {
+				if rerr := s.redeliver(queue, msg, opts); rerr != nil {
+					c.logf("Redelivering message failed: %s\n", rerr.Error())
+				}
+			} else {
+				msg.Nack(false, requeue)
+				s.onNack(queue, requeue)
+			}
+		}
+		if errors.Is(err, ErrHandlerPanic) {
+			// logged with the stack already
+			return false, nil
+		}
+		if opts.ContinueOnError || errors.Is(err, ErrNoRoute) {
+			c.logf("Handler failed: %s\n", err.Error())
+			return false, nil
+		}
+		return true, &handlerError{err}
+	}
+
+	if !opts.AutoAck {
+		msg.Ack(false)
+		s.onAck(queue)
+	}
+
+	// If subscriber doesn't want to publish response
+	// skip the response publishing part
+	if opts.PublishResponse {
+		if msg.ReplyTo == "" {
+			c.logf("Message has no reply-to, not publishing the response\n")
+			return true, nil
+		}
+
+		if err = s.publishReply(ctx, msg, resp); err != nil {
+			return true, fmt.Errorf("publish reply to [%s]: %w", msg.ReplyTo, err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,76 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestReplyCorrelationID(t *testing.T) {
+	msg := amqp.Delivery{CorrelationId: "req-1", ReplyTo: "replies"}
+
+	if got := reply(msg, amqp.Publishing{}).CorrelationId; got != "req-1" {
+		t.Errorf("reply correlation ID = %q, want the request's %q", got, "req-1")
+	}
+	if got := reply(msg, amqp.Publishing{CorrelationId: "own"}).CorrelationId; got != "own" {
+		t.Errorf("reply correlation ID = %q, want the handler's %q", got, "own")
+	}
+}
+
+// TestSubscribeReplyRoundTrip runs a request through Subscribe against the
+// stub broker and checks that its reply reaches the ReplyTo queue
+func TestSubscribeReplyRoundTrip(t *testing.T) {
+	c, connOpts := stubClient(t)
+	c.SetLogger(NopLogger())
+	broker := newStubBroker()
+	connOpts.Config = broker.config()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, name := range []string{"requests", "replies"} {
+		if _, err := c.QueueDeclare(name, nil, connOpts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := amqp.Publishing{Body: []byte("ping"), ReplyTo: "replies", CorrelationId: "req-1"}
+	if err := c.Publish(request, "", "requests", nil, connOpts); err != nil {
+		t.Fatalf("publish request: %v", err)
+	}
+
+	opts := DefaultSubscribeOpts()
+	opts.PublishResponse = true
+	err := c.Subscribe(ctx, "requests", opts, nil, connOpts,
+		func(msg amqp.Delivery) (amqp.Publishing, error) {
+			return amqp.Publishing{Body: append([]byte("pong: "), msg.Body...)}, nil
+		})
+	if err != nil {
+		t.Fatalf("subscribe to requests: %v", err)
+	}
+
+	var reply amqp.Delivery
+	err = c.Subscribe(ctx, "replies", DefaultSubscribeOpts(), nil, connOpts,
+		func(msg amqp.Delivery) (amqp.Publishing, error) {
+			reply = msg
+			return amqp.Publishing{}, nil
+		})
+	if err != nil {
+		t.Fatalf("subscribe to replies: %v", err)
+	}
+
+	if reply.Exchange != "" || reply.RoutingKey != "replies" {
+		t.Errorf("reply published to exchange %q with key %q, want the default exchange with the ReplyTo %q",
+			reply.Exchange, reply.RoutingKey, "replies")
+	}
+	if reply.CorrelationId != "req-1" {
+		t.Errorf("reply correlation ID = %q, want the request's %q", reply.CorrelationId, "req-1")
+	}
+	if got := string(reply.Body); got != "pong: ping" {
+		t.Errorf("reply body = %q, want %q", got, "pong: ping")
+	}
+	if n := len(broker.queued("requests")); n != 0 {
+		t.Errorf("%d requests left in the queue, want the request acked", n)
+	}
+}
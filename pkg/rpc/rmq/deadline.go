@@ -0,0 +1,48 @@
+package rmq
+
+import (
+	"net"
+	"time"
+)
+
+// deadlineConn sets a deadline before every read and write so that reads
+// and writes on a half-open connection fail instead of blocking forever
+type deadlineConn struct {
+	net.Conn
+	read  time.Duration // 0 means no read deadline
+	write time.Duration // 0 means no write deadline
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.read > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.read)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.write)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+// withDeadlines wraps the connections returned by dial
+// with the read and write timeouts
+func withDeadlines(
+	dial func(network, addr string) (net.Conn, error),
+	read, write time.Duration,
+) func(network, addr string) (net.Conn, error) {
+
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &deadlineConn{Conn: conn, read: read, write: write}, nil
+	}
+}
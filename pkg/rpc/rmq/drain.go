@@ -0,0 +1,129 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// drainPollInterval is the longest wait of Drain between
+// two checks of an empty queue
+const drainPollInterval = 100 * time.Millisecond
+
+/*
+DrainOpts ...
+
+IdleTimeout is how long Drain keeps waiting for new messages once the queue
+is empty, counted from the last message handled. Use it when producers may
+still be publishing, e.g. a few messages per second, so that a queue being
+empty for a moment doesn't end the drain. Zero stops as soon as the queue is
+found empty.
+*/
+type DrainOpts struct {
+	IdleTimeout time.Duration // default 0
+}
+
+// DefaultDrainOpts returns default drain options
+func DefaultDrainOpts() *DrainOpts {
+	return &DrainOpts{
+		IdleTimeout: 0,
+	}
+}
+
+/*
+Drain handles the messages of a queue one at a time until the queue is
+empty and returns the number of messages handled, e.g. for batch jobs. Each
+message is fetched with basic.get and acked once handler returns nil. When
+handler fails the message is requeued and Drain returns the error.
+
+ctx is the context object that can be used to stop draining, Drain then
+returns ctx.Err()
+
+queue is the name of the queue to drain
+
+opts sets how long to wait for new messages once the queue is empty
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+handler is a function that will process the messages, see Consume
+*/
+func (c *Client) Drain(
+	ctx context.Context,
+	queue string,
+	opts *DrainOpts,
+	connOpts *ConnectOpts,
+	handler func(ctx context.Context, msg amqp.Delivery) error,
+) (int, error) {
+
+	defaultOpts := DefaultDrainOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	handled := 0
+	last := time.Now()
+	for {
+		var msg amqp.Delivery
+		var ok bool
+		err = s.do(ctx, func() (err error) {
+			msg, ok, err = s.ch.Get(queue, false)
+			if err != nil {
+				return fmt.Errorf("get from queue [%s]: %w", queue, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return handled, err
+		}
+
+		if !ok {
+			idle := time.Since(last)
+			if idle >= defaultOpts.IdleTimeout {
+				return handled, nil
+			}
+
+			wait := defaultOpts.IdleTimeout - idle
+			if wait > drainPollInterval {
+				wait = drainPollInterval
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return handled, ctx.Err()
+			}
+			continue
+		}
+
+		s.onDeliver(queue)
+
+		hctx, cancel := context.WithCancel(ctx)
+		hctx, end := s.startSpan(hctx, queue, msg)
+		err = handler(hctx, msg)
+		end(err)
+		cancel()
+
+		if err != nil {
+			msg.Nack(false, true)
+			s.onNack(queue, true)
+			return handled, err
+		}
+
+		msg.Ack(false)
+		s.onAck(queue)
+		handled++
+		last = time.Now()
+	}
+}
@@ -0,0 +1,103 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrKeyTooLong is returned for routing keys longer than the
+// 255 bytes AMQP allows, which would otherwise be truncated
+var ErrKeyTooLong = errors.New("routing key longer than 255 bytes")
+
+// ErrInvalidTable is returned for headers or arguments holding values which
+// can't be encoded as AMQP field values, e.g. structs or unsigned integers
+// wider than a byte
+var ErrInvalidTable = errors.New("table holds a value AMQP can't encode")
+
+// checkTable returns ErrInvalidTable if t can't be sent, name tells
+// which table is invalid. The supported types are those accepted by
+// amqp.Table.Validate, nested tables and slices included.
+func checkTable(name string, t amqp.Table) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidTable, name, err.Error())
+	}
+	return nil
+}
+
+// maxKeyLen is the maximum length of an AMQP short string
+const maxKeyLen = 255
+
+// checkKey returns ErrKeyTooLong if key can't be sent as routing key.
+// An empty key is fine, e.g. for fanout exchanges which ignore it.
+func checkKey(key string) error {
+	if len(key) > maxKeyLen {
+		return fmt.Errorf("%w: %d bytes", ErrKeyTooLong, len(key))
+	}
+	return nil
+}
+
+// hasCode reports whether err wraps an *amqp.Error with the reply code
+func hasCode(err error, code int) bool {
+	var amqpErr *amqp.Error
+	return errors.As(err, &amqpErr) && amqpErr.Code == code
+}
+
+// IsNotFound reports whether err was caused by the server not finding
+// an exchange or queue (404), e.g. when inspecting a missing queue
+func IsNotFound(err error) bool {
+	return hasCode(err, amqp.NotFound)
+}
+
+// IsAccessRefused reports whether err was caused by the user lacking the
+// permissions for the operation (403) or by an exclusive queue of
+// another connection
+func IsAccessRefused(err error) bool {
+	return hasCode(err, amqp.AccessRefused)
+}
+
+// IsPreconditionFailed reports whether err was caused by a failed
+// precondition (406), e.g. redeclaring a queue with different args
+func IsPreconditionFailed(err error) bool {
+	return hasCode(err, amqp.PreconditionFailed)
+}
+
+// IsResourceLocked reports whether err was caused by a resource
+// locked by another connection (405), e.g. an exclusive queue
+func IsResourceLocked(err error) bool {
+	return hasCode(err, amqp.ResourceLocked)
+}
+
+// IsConnectionClosed reports whether err was caused by the connection or
+// channel being closed, by the server, a network failure or the client.
+// Such operations may succeed when retried on a new connection.
+func IsConnectionClosed(err error) bool {
+	if errors.Is(err, amqp.ErrClosed) || errors.Is(err, errConnectionClosed) {
+		return true
+	}
+	return hasCode(err, amqp.ConnectionForced)
+}
+
+/*
+IsRetryable is the default ConnectOpts.IsRetryable. It reports whether
+connecting again may succeed after failing with err.
+
+Errors refusing access (403) are fatal, i.e. bad credentials, no common SASL
+mechanism or no access to the vhost, as is a host name that doesn't resolve.
+Everything else is retryable, e.g. refused or timed out TCP connections,
+DNS servers failing temporarily and connections closed by the server.
+*/
+func IsRetryable(err error) bool {
+	if IsAccessRefused(err) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+
+	return true
+}
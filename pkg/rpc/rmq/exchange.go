@@ -1,9 +1,33 @@
 package rmq
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/streadway/amqp"
 )
 
+// ErrUnknownExchangeKind is returned when declaring an exchange of a
+// kind which is neither built into RabbitMQ nor a known plugin type
+var ErrUnknownExchangeKind = errors.New("unknown exchange kind")
+
+// exchangeKinds are the kinds built into RabbitMQ followed by
+// those of the plugins shipped with it or commonly installed
+var exchangeKinds = []string{
+	amqp.ExchangeDirect,
+	amqp.ExchangeFanout,
+	amqp.ExchangeTopic,
+	amqp.ExchangeHeaders,
+	"x-delayed-message",
+	"x-consistent-hash",
+	"x-modulus-hash",
+	"x-random",
+	"x-recent-history",
+	"x-jms-topic",
+}
+
 /*
 DeclareExchangeOpts ...
 
@@ -43,6 +67,20 @@ respond to any exceptions.
 
 Optional amqp.Table of arguments that are specific to the server's implementation
 of the exchange can be sent for exchange types that require extra parameters.
+
+AlternateExchange sets the alternate-exchange argument. Messages which can not
+be routed to any queue are then republished to that exchange instead of being
+dropped, typically a fanout exchange with a queue collecting them. A key
+already present in Args takes precedence.
+
+Kind is checked against the known exchange kinds before declaring, so that a
+typo fails with a clear error. Set AllowUnknownKind to declare exchanges of
+other plugins.
+
+Delayed declares an exchange of the rabbitmq_delayed_message_exchange plugin
+which routes like Kind once the delay of a message, see PublishOpts.Delay,
+has passed. The exchange is declared as x-delayed-message with Kind as its
+x-delayed-type argument.
 */
 type DeclareExchangeOpts struct {
 	Kind        string     // default amqp.ExchangeDirect
@@ -51,6 +89,10 @@ type DeclareExchangeOpts struct {
 	Internal    bool       // default false
 	NoWait      bool       // default false
 	Args        amqp.Table // default nil
+
+	AlternateExchange string // default ""
+	AllowUnknownKind  bool   // default false
+	Delayed           bool   // default false
 }
 
 // DefaultDeclareExchangeOpts returns default DeclareExchangeOpts
@@ -65,6 +107,59 @@ func DefaultDeclareExchangeOpts() *DeclareExchangeOpts {
 	}
 }
 
+// validate checks that Kind is a known exchange kind unless allowed otherwise
+func (o *DeclareExchangeOpts) validate() error {
+	if err := checkTable("args", o.Args); err != nil {
+		return err
+	}
+
+	if o.Delayed && o.Kind == "x-delayed-message" {
+		return fmt.Errorf("%w [%s] for a delayed exchange, Kind is the kind to route like",
+			ErrUnknownExchangeKind, o.Kind)
+	}
+
+	if o.AllowUnknownKind {
+		return nil
+	}
+
+	for _, kind := range exchangeKinds {
+		if o.Kind == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w [%s], must be one of %s",
+		ErrUnknownExchangeKind, o.Kind, strings.Join(exchangeKinds, ", "))
+}
+
+// kind returns the kind the exchange is declared with
+func (o *DeclareExchangeOpts) kind() string {
+	if o.Delayed {
+		return "x-delayed-message"
+	}
+	return o.Kind
+}
+
+// args returns Args merged with the arguments of the convenience fields,
+// Args itself is not modified
+func (o *DeclareExchangeOpts) args() amqp.Table {
+	args := amqp.Table{}
+	if o.AlternateExchange != "" {
+		args["alternate-exchange"] = o.AlternateExchange
+	}
+	if o.Delayed {
+		args["x-delayed-type"] = o.Kind
+	}
+
+	if len(args) == 0 {
+		return o.Args
+	}
+
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	return args
+}
+
 /*
 ExchangeDeclare declares an exchange on the RabbitMQ server
 
@@ -76,41 +171,118 @@ connOpts provides connection options such as retry to connect if connection
 closes or fails and number of retries to attempt.
 */
 func (c *Client) ExchangeDeclare(name string, opts *DeclareExchangeOpts, connOpts *ConnectOpts) error {
-	defaultOpts := DefaultDeclareExchangeOpts()
+	return c.ExchangeDeclareContext(context.Background(), name, opts, connOpts)
+}
 
-	// update defaultOpts if opts provided
+// ExchangeDeclareContext is like ExchangeDeclare but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) ExchangeDeclareContext(
+	ctx context.Context,
+	name string,
+	opts *DeclareExchangeOpts,
+	connOpts *ConnectOpts) error {
+
+	// fail on invalid options before connecting
 	if opts != nil {
-		defaultOpts = opts
+		if err := opts.validate(); err != nil {
+			return fmt.Errorf("declare exchange [%s]: %w", name, err)
+		}
 	}
 
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
-	}
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.ExchangeDeclare(name, opts)
+	})
+}
 
-	conn, err := c.connect(defaultConnOpts)
-	if err != nil {
-		return err
+// ExchangeDeclare declares an exchange on the session channel,
+// see Client.ExchangeDeclare
+func (s *Session) ExchangeDeclare(name string, opts *DeclareExchangeOpts) error {
+	defaultOpts := DefaultDeclareExchangeOpts()
+
+	// update defaultOpts if opts provided
+	if opts != nil {
+		defaultOpts = opts
 	}
-	defer conn.Close()
 
-	ch, err := conn.Channel()
+	err := defaultOpts.validate()
 	if err != nil {
-		return err
+		return fmt.Errorf("declare exchange [%s]: %w", name, err)
 	}
-	defer ch.Close()
 
-	err = ch.ExchangeDeclare(
+	err = s.ch.ExchangeDeclare(
 		name,                    // name
-		defaultOpts.Kind,        // type
+		defaultOpts.kind(),      // type
 		defaultOpts.Durable,     // durable
 		defaultOpts.AutoDeleted, // auto-deleted
 		defaultOpts.Internal,    // internal
 		defaultOpts.NoWait,      // no-wait
-		defaultOpts.Args,        // arguments
+		defaultOpts.args(),      // arguments
 	)
 	if err != nil {
-		return err
+		return fmt.Errorf("declare exchange [%s]: %w", name, err)
+	}
+
+	return nil
+}
+
+/*
+ExchangeDeclarePassive checks that an exchange exists on the RabbitMQ server
+without declaring it, e.g. to verify the topology with credentials which are
+not allowed to declare exchanges
+
+name is name of the exhange
+
+opts is options the exchange is expected to be declared with
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+If the exchange does not exist the returned error satisfies IsNotFound. Like
+for queues, the server does not compare the options of a passive declaration
+with those of the exchange. Use ExchangeDeclare to assert the kind, it fails
+with an error satisfying IsPreconditionFailed if the kind differs.
+*/
+func (c *Client) ExchangeDeclarePassive(name string, opts *DeclareExchangeOpts, connOpts *ConnectOpts) error {
+	return c.ExchangeDeclarePassiveContext(context.Background(), name, opts, connOpts)
+}
+
+// ExchangeDeclarePassiveContext is like ExchangeDeclarePassive but stops
+// retrying to connect as soon as ctx is done
+func (c *Client) ExchangeDeclarePassiveContext(
+	ctx context.Context,
+	name string,
+	opts *DeclareExchangeOpts,
+	connOpts *ConnectOpts) error {
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.ExchangeDeclarePassive(name, opts)
+	})
+}
+
+// ExchangeDeclarePassive checks that an exchange exists using the
+// session channel, see Client.ExchangeDeclarePassive
+func (s *Session) ExchangeDeclarePassive(name string, opts *DeclareExchangeOpts) error {
+	defaultOpts := DefaultDeclareExchangeOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	err := s.ch.ExchangeDeclarePassive(
+		name,
+		defaultOpts.kind(),
+		defaultOpts.Durable,
+		defaultOpts.AutoDeleted,
+		defaultOpts.Internal,
+		defaultOpts.NoWait,
+		defaultOpts.args(),
+	)
+	if err != nil {
+		// the server closes the channel with 404 for unknown exchanges
+		if IsNotFound(err) {
+			return fmt.Errorf("exchange [%s] does not exist: %w", name, err)
+		}
+		return fmt.Errorf("declare exchange [%s] passively: %w", name, err)
 	}
 
 	return nil
@@ -134,24 +306,174 @@ connOpts provides connection options such as retry to connect if connection
 closes or fails and number of retries to attempt.
 */
 func (c *Client) ExchangeDelete(name string, ifUnused, noWait bool, connOpts *ConnectOpts) error {
+	return c.ExchangeDeleteContext(context.Background(), name, ifUnused, noWait, connOpts)
+}
+
+// ExchangeDeleteContext is like ExchangeDelete but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) ExchangeDeleteContext(
+	ctx context.Context,
+	name string,
+	ifUnused, noWait bool,
+	connOpts *ConnectOpts) error {
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.ExchangeDelete(name, ifUnused, noWait)
+	})
+}
 
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
+// ExchangeDelete removes the named exchange using the session channel,
+// see Client.ExchangeDelete
+func (s *Session) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	if err := s.ch.ExchangeDelete(name, ifUnused, noWait); err != nil {
+		return fmt.Errorf("delete exchange [%s]: %w", name, err)
 	}
+	return nil
+}
+
+// ExchangeBindOpts ...
+type ExchangeBindOpts struct {
+	NoWait bool       // default false
+	Args   amqp.Table // default nil
+}
+
+// DefaultExchangeBindOpts ...
+func DefaultExchangeBindOpts() *ExchangeBindOpts {
+	return &ExchangeBindOpts{
+		NoWait: false,
+		Args:   nil,
+	}
+}
+
+/*
+ExchangeBind binds the destination exchange to the source exchange so that
+messages published to source and matching the routing key are routed to
+destination as well. This allows exchange-to-exchange topologies.
+
+destination exchange which receives the messages
+
+key used for routing messages from source to destination
+
+source exchange on which the messages are published
+
+opts providing exchange binding options
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) ExchangeBind(
+	destination, key, source string,
+	opts *ExchangeBindOpts,
+	connOpts *ConnectOpts) error {
 
-	conn, err := c.connect(defaultConnOpts)
+	return c.ExchangeBindContext(context.Background(), destination, key, source, opts, connOpts)
+}
+
+// ExchangeBindContext is like ExchangeBind but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) ExchangeBindContext(
+	ctx context.Context,
+	destination, key, source string,
+	opts *ExchangeBindOpts,
+	connOpts *ConnectOpts) error {
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.ExchangeBind(destination, key, source, opts)
+	})
+}
+
+// ExchangeBind binds the destination exchange to the source exchange
+// using the session channel, see Client.ExchangeBind
+func (s *Session) ExchangeBind(destination, key, source string, opts *ExchangeBindOpts) error {
+	defaultOpts := DefaultExchangeBindOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	err := checkKey(key)
+	if err == nil {
+		err = checkTable("args", defaultOpts.Args)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("bind exchange [%s] to exchange [%s] with key [%s]: %w",
+			destination, source, key, err)
 	}
-	defer conn.Close()
 
-	ch, err := conn.Channel()
+	err = s.ch.ExchangeBind(
+		destination,
+		key,
+		source,
+		defaultOpts.NoWait,
+		defaultOpts.Args,
+	)
 	if err != nil {
-		return err
+		return fmt.Errorf("bind exchange [%s] to exchange [%s] with key [%s]: %w",
+			destination, source, key, err)
 	}
-	defer ch.Close()
+	return nil
+}
 
-	err = ch.ExchangeDelete(name, ifUnused, noWait)
+/*
+ExchangeUnbind removes the binding between the destination and the source
+exchange matching the routing key and arguments
+
+destination exchange which receives the messages
+
+key used when the binding was declared
+
+source exchange on which the messages are published
+
+opts providing the binding options used when the binding was declared
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) ExchangeUnbind(
+	destination, key, source string,
+	opts *ExchangeBindOpts,
+	connOpts *ConnectOpts) error {
+
+	return c.ExchangeUnbindContext(context.Background(), destination, key, source, opts, connOpts)
+}
+
+// ExchangeUnbindContext is like ExchangeUnbind but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) ExchangeUnbindContext(
+	ctx context.Context,
+	destination, key, source string,
+	opts *ExchangeBindOpts,
+	connOpts *ConnectOpts) error {
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.ExchangeUnbind(destination, key, source, opts)
+	})
+}
+
+// ExchangeUnbind removes the binding between two exchanges
+// using the session channel, see Client.ExchangeUnbind
+func (s *Session) ExchangeUnbind(destination, key, source string, opts *ExchangeBindOpts) error {
+	defaultOpts := DefaultExchangeBindOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	if err := checkTable("args", defaultOpts.Args); err != nil {
+		return fmt.Errorf("unbind exchange [%s] from exchange [%s] with key [%s]: %w",
+			destination, source, key, err)
+	}
+
+	err := s.ch.ExchangeUnbind(
+		destination,
+		key,
+		source,
+		defaultOpts.NoWait,
+		defaultOpts.Args,
+	)
+	if err != nil {
+		return fmt.Errorf("unbind exchange [%s] from exchange [%s] with key [%s]: %w",
+			destination, source, key, err)
+	}
 	return nil
 }
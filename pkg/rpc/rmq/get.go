@@ -0,0 +1,63 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+/*
+Get fetches a single message from a queue with basic.get instead of
+consuming. ok is false if the queue was empty.
+
+The channel used by Get is closed once it returns, so without autoAck the
+message can not be acked and the server requeues it right away. Use
+Session.Get to fetch messages which are acked after handling them.
+
+queue is the name of the queue
+
+autoAck lets the server consider the message acknowledged on delivery
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) Get(queue string, autoAck bool, connOpts *ConnectOpts) (msg amqp.Delivery, ok bool, err error) {
+	return c.GetContext(context.Background(), queue, autoAck, connOpts)
+}
+
+// GetContext is like Get but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) GetContext(
+	ctx context.Context,
+	queue string,
+	autoAck bool,
+	connOpts *ConnectOpts) (msg amqp.Delivery, ok bool, err error) {
+
+	err = c.run(ctx, connOpts, func(s *Session) (err error) {
+		msg, ok, err = s.Get(queue, autoAck)
+		return err
+	})
+	return msg, ok, err
+}
+
+// Get fetches a single message using the session channel, see Client.Get.
+// Without autoAck the message must be acked or nacked before the session
+// is closed, else the server requeues it.
+func (s *Session) Get(queue string, autoAck bool) (msg amqp.Delivery, ok bool, err error) {
+	if !autoAck {
+		// unacked messages stay with the channel until it closes
+		s.taint()
+	}
+
+	msg, ok, err = s.ch.Get(queue, autoAck)
+	if err != nil {
+		return msg, false, fmt.Errorf("get from queue [%s]: %w", queue, err)
+	}
+	if !ok {
+		return msg, false, nil
+	}
+
+	s.onDeliver(queue)
+	return msg, true, nil
+}
@@ -0,0 +1,90 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+// errDecode marks deliveries which could not be decoded by SubscribeJSON
+var errDecode = errors.New("decoding message body")
+
+/*
+PublishJSON marshals v to JSON and publishes it to the exchange with the
+content type application/json
+
+ctx is the context object, see PublishContext
+
+exchange is the name of exchange where this message will be published
+
+key is the routing key that will be used for routing the message on exchange
+to different queues
+
+v is the value to marshal into the message body
+
+opts is option for publishing a message
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) PublishJSON(
+	ctx context.Context,
+	exchange, key string,
+	v interface{},
+	opts *PublishOpts,
+	connOpts *ConnectOpts) error {
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.PublishContext(ctx, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}, exchange, key, opts, connOpts)
+}
+
+/*
+SubscribeJSON is like Subscribe but unmarshals the JSON body of every
+delivery into a T before calling handler with it. Deliveries which cannot
+be unmarshalled are nacked without being requeued, as they would fail again,
+and are otherwise treated like a handler error.
+
+See Subscribe for the other parameters.
+*/
+func SubscribeJSON[T any](
+	ctx context.Context,
+	c *Client,
+	queue string,
+	opts *SubscribeOpts,
+	chanOpts *ChannelOpts,
+	connOpts *ConnectOpts,
+	handler func(T, amqp.Delivery) (amqp.Publishing, error),
+) error {
+
+	defaultOpts := *DefaultSubscribeOpts()
+	if opts != nil {
+		defaultOpts = *opts
+	}
+
+	policy := defaultOpts.RequeuePolicy
+	defaultOpts.RequeuePolicy = func(msg amqp.Delivery, err error) bool {
+		if errors.Is(err, errDecode) {
+			return false
+		}
+		return policy == nil || policy(msg, err)
+	}
+
+	return c.Subscribe(ctx, queue, &defaultOpts, chanOpts, connOpts,
+		func(msg amqp.Delivery) (amqp.Publishing, error) {
+			var v T
+			if err := json.Unmarshal(msg.Body, &v); err != nil {
+				return amqp.Publishing{}, fmt.Errorf("%w: %s", errDecode, err.Error())
+			}
+			return handler(v, msg)
+		})
+}
@@ -0,0 +1,61 @@
+package rmq
+
+import (
+	"log"
+)
+
+// Logger is used by the client to report retries, purged messages and
+// other informational events. *log.Logger satisfies this interface, as
+// do the sugared loggers of most structured logging libraries.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger writes to the standard logger of the log package
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...interface{}) {}
+
+// NopLogger returns a Logger which discards everything
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// SetLogger replaces the logger used by the client, by default the
+// standard logger of the log package is used. Passing nil restores
+// the default. Sessions already open keep the previous logger.
+func (c *Client) SetLogger(l Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.logger = l
+}
+
+func (c *Client) logf(format string, v ...interface{}) {
+	c.getLogger().Printf(format, v...)
+}
+
+// loggerFor returns the logger of an operation with opts,
+// see ConnectOpts.Logger
+func (c *Client) loggerFor(opts *ConnectOpts) Logger {
+	if opts != nil && opts.Logger != nil {
+		return opts.Logger
+	}
+	return c.getLogger()
+}
+
+func (c *Client) getLogger() Logger {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.logger == nil {
+		return stdLogger{}
+	}
+	return c.logger
+}
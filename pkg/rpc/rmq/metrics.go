@@ -0,0 +1,77 @@
+package rmq
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+MetricsHook receives the events of a client so that they can be exported as
+metrics, e.g. by implementing it with Prometheus counters and histograms.
+
+The callbacks are called synchronously from the goroutine doing the work and
+must return quickly. Implementations must be safe for concurrent use.
+*/
+type MetricsHook interface {
+	// OnPublish is called once a publishing is done, dur includes
+	// waiting for the confirmation if one was requested
+	OnPublish(exchange, key string, err error, dur time.Duration)
+
+	// OnDeliver is called for every delivery received by Subscribe
+	OnDeliver(queue string)
+
+	// OnAck is called when a delivery was handled and acked
+	OnAck(queue string)
+
+	// OnNack is called when a delivery was nacked
+	OnNack(queue string, requeue bool)
+
+	// OnReconnect is called before every retry to connect
+	// and before every resubscribe of SubscribeForever
+	OnReconnect()
+}
+
+// SetMetricsHook sets the hook receiving the events of the client, nil
+// (the default) disables it. Sessions already open keep the previous hook.
+func (c *Client) SetMetricsHook(m MetricsHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = m
+}
+
+func (c *Client) onReconnect() {
+	atomic.AddUint64(&c.stats.reconnects, 1)
+
+	c.mu.RLock()
+	m := c.metrics
+	c.mu.RUnlock()
+
+	if m != nil {
+		m.OnReconnect()
+	}
+}
+
+func (s *Session) onPublish(exchange, key string, err error, start time.Time) {
+	if s.metrics != nil {
+		s.metrics.OnPublish(exchange, key, err, time.Since(start))
+	}
+}
+
+func (s *Session) onDeliver(queue string) {
+	if s.metrics != nil {
+		s.metrics.OnDeliver(queue)
+	}
+}
+
+func (s *Session) onAck(queue string) {
+	if s.metrics != nil {
+		s.metrics.OnAck(queue)
+	}
+}
+
+func (s *Session) onNack(queue string, requeue bool) {
+	if s.metrics != nil {
+		s.metrics.OnNack(queue, requeue)
+	}
+}
@@ -0,0 +1,58 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrHandlerPanic is wrapped by the *PanicError of a handler
+// which panicked, see SubscribeOpts.RecoverPanics
+var ErrHandlerPanic = errors.New("handler panicked")
+
+// PanicError is the error of a delivery whose handler panicked
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrHandlerPanic.Error(), e.Value)
+}
+
+func (e *PanicError) Unwrap() error {
+	return ErrHandlerPanic
+}
+
+// call runs handler on msg. If opts ask for it a panic of the handler is
+// logged with its stack and passed to opts.PanicHandler, and returned as
+// a *PanicError.
+func (c *Client) call(
+	ctx context.Context,
+	msg amqp.Delivery,
+	opts *SubscribeOpts,
+	handler Handler,
+) (resp amqp.Publishing, err error) {
+
+	if !opts.RecoverPanics && opts.PanicHandler == nil {
+		return handler(ctx, msg)
+	}
+
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		perr := &PanicError{Value: v, Stack: debug.Stack()}
+		c.logf("Handler panicked: %v\n%s\n", v, perr.Stack)
+		if opts.PanicHandler != nil {
+			opts.PanicHandler(v, msg)
+		}
+		resp, err = amqp.Publishing{}, perr
+	}()
+	return handler(ctx, msg)
+}
@@ -0,0 +1,42 @@
+package rmq
+
+import (
+	"context"
+)
+
+/*
+Ping checks that the RabbitMQ server is reachable by connecting and opening a
+channel, which is closed right away. Nothing is declared on the server, so it
+is suited for liveness and readiness probes.
+
+For a pooled client a live connection of the pool is used when available,
+so Ping then only checks that a channel can be opened on it.
+
+ctx is the context object bounding the check, Ping returns ctx.Err()
+as soon as it is done even if connecting is still in progress
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) Ping(ctx context.Context, connOpts *ConnectOpts) error {
+	ctx, cancel := withTimeout(ctx, connOpts)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		s, err := c.OpenSessionContext(ctx, connOpts)
+		if err != nil {
+			result <- err
+			return
+		}
+		result <- s.Close()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		// the session is closed by the goroutine once opened
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,305 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrPoolClosed is returned when an operation is attempted on a
+// pooled client after Close has been called
+var ErrPoolClosed = errors.New("connection pool closed")
+
+// PoolOpts to specify how many connections a pooled client
+// keeps open and for how long an unused connection is kept
+//
+// Channels of finished operations are kept open on their connection, up to
+// MaxChannelsPerConn per connection, and reused by later operations instead
+// of opening a new channel every time. Channels closed by the server, e.g.
+// after a failed declare, are dropped and replaced by new ones. Channels of
+// sessions which changed the channel state, by consuming, setting the
+// prefetch limits or entering confirm mode, are always closed.
+type PoolOpts struct {
+	MaxConns           int           // Maximum number of live connections, default 2
+	MaxChannelsPerConn int           // Idle channels kept open per connection, default 16, 0 closes them
+	IdleTimeout        time.Duration // Close connections unused for this long, 0 keeps them open
+}
+
+// DefaultPoolOpts returns default pool options
+func DefaultPoolOpts() *PoolOpts {
+	return &PoolOpts{
+		MaxConns:           2,
+		MaxChannelsPerConn: 16,
+		IdleTimeout:        5 * time.Minute,
+	}
+}
+
+// pooledConn is a connection owned by the pool along with
+// the bookkeeping needed to share and reap it
+type pooledConn struct {
+	conn     *amqp.Connection
+	refs     int       // number of operations currently using conn
+	lastUsed time.Time // last time refs dropped to zero
+	idle     []*pooledChan
+}
+
+// pooledChan is a channel kept open for reuse along with
+// the chan reporting that it was closed
+type pooledChan struct {
+	ch     *amqp.Channel
+	closes chan *amqp.Error
+}
+
+func openChan(conn *amqp.Connection) (*pooledChan, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return &pooledChan{ch: ch, closes: ch.NotifyClose(make(chan *amqp.Error, 1))}, nil
+}
+
+// broken reports whether the channel was closed, by the
+// server on a channel exception or with its connection
+func (pch *pooledChan) broken() bool {
+	select {
+	case <-pch.closes:
+		return true
+	default:
+		return false
+	}
+}
+
+// connPool keeps a bounded set of live connections. AMQP connections
+// are multiplexed, so a connection is shared by concurrent operations
+// and each operation opens its own channel on it.
+type connPool struct {
+	mu      sync.Mutex
+	opts    PoolOpts
+	conns   []*pooledConn
+	dialing int
+	dialed  chan struct{} // closed and replaced once a dial finished
+	closed  bool
+	done    chan struct{}
+}
+
+func newConnPool(opts *PoolOpts) *connPool {
+	defaultOpts := DefaultPoolOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	p := &connPool{
+		opts:   *defaultOpts,
+		dialed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if p.opts.MaxConns < 1 {
+		p.opts.MaxConns = 1
+	}
+
+	if p.opts.IdleTimeout > 0 {
+		go p.reaper()
+	}
+	return p
+}
+
+// get returns a live connection from the pool, dialing a new one when
+// every live connection is busy and the pool has room. When the pool has
+// no live connection and is full of dials in progress it waits for one of
+// them until ctx is done.
+func (p *connPool) get(ctx context.Context, dial func() (*amqp.Connection, error)) (*pooledConn, error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+
+		p.prune()
+
+		var least *pooledConn
+		for _, pc := range p.conns {
+			if least == nil || pc.refs < least.refs {
+				least = pc
+			}
+		}
+
+		// Share an existing connection if it is idle or
+		// if the pool can not grow any further
+		full := len(p.conns)+p.dialing >= p.opts.MaxConns
+		if least != nil && (least.refs == 0 || full) {
+			least.refs++
+			p.mu.Unlock()
+			return least, nil
+		}
+		if !full {
+			break
+		}
+
+		dialed := p.dialed
+		p.mu.Unlock()
+		select {
+		case <-dialed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mu.Lock()
+	}
+
+	p.dialing++
+	p.mu.Unlock()
+
+	conn, err := dial()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.dialing--
+	close(p.dialed)
+	p.dialed = make(chan struct{})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.closed {
+		conn.Close()
+		return nil, ErrPoolClosed
+	}
+
+	pc := &pooledConn{conn: conn, refs: 1}
+	p.conns = append(p.conns, pc)
+	return pc, nil
+}
+
+// channel returns an idle channel of pc, opening a new one if
+// there is none. pc must have been returned by get.
+func (p *connPool) channel(pc *pooledConn) (*pooledChan, error) {
+	p.mu.Lock()
+	for len(pc.idle) > 0 {
+		pch := pc.idle[len(pc.idle)-1]
+		pc.idle[len(pc.idle)-1] = nil
+		pc.idle = pc.idle[:len(pc.idle)-1]
+
+		if !pch.broken() {
+			p.mu.Unlock()
+			return pch, nil
+		}
+	}
+	p.mu.Unlock()
+
+	return openChan(pc.conn)
+}
+
+// put hands a connection back to the pool once an operation is done with
+// it. pch is the channel of the operation to keep for reuse, if not nil.
+func (p *connPool) put(pc *pooledConn, pch *pooledChan) {
+	p.mu.Lock()
+
+	pc.refs--
+	pc.lastUsed = time.Now()
+
+	if pch != nil && !p.closed && !pc.conn.IsClosed() && !pch.broken() &&
+		len(pc.idle) < p.opts.MaxChannelsPerConn {
+		pc.idle = append(pc.idle, pch)
+		pch = nil
+	}
+
+	if pc.refs == 0 && (p.closed || pc.conn.IsClosed()) {
+		p.remove(pc)
+		pc.conn.Close()
+	}
+	p.mu.Unlock()
+
+	if pch != nil {
+		pch.ch.Close()
+	}
+}
+
+// prune drops connections closed by the server so that they are
+// transparently replaced on the next get. Must be called with mu held.
+func (p *connPool) prune() {
+	live := p.conns[:0]
+	for _, pc := range p.conns {
+		if !pc.conn.IsClosed() {
+			live = append(live, pc)
+		}
+	}
+	for i := len(live); i < len(p.conns); i++ {
+		p.conns[i] = nil
+	}
+	p.conns = live
+}
+
+// remove drops pc from the pool. Must be called with mu held.
+func (p *connPool) remove(pc *pooledConn) {
+	for i := range p.conns {
+		if p.conns[i] == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// reaper periodically closes connections which have been
+// idle for longer than IdleTimeout
+func (p *connPool) reaper() {
+	interval := p.opts.IdleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.reap()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *connPool) reap() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, pc := range append([]*pooledConn(nil), p.conns...) {
+		if pc.refs == 0 && now.Sub(pc.lastUsed) > p.opts.IdleTimeout {
+			p.remove(pc)
+			pc.conn.Close()
+		}
+	}
+	p.prune()
+}
+
+// close closes idle connections right away and marks the pool
+// closed, busy connections are closed as soon as they are put back
+func (p *connPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	var err error
+	for _, pc := range append([]*pooledConn(nil), p.conns...) {
+		if pc.refs > 0 {
+			continue
+		}
+		p.remove(pc)
+		if cerr := pc.conn.Close(); cerr != nil && cerr != amqp.ErrClosed && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+/*
+Publisher publishes to a fixed exchange and routing key on a channel it
+keeps open, for hot loops where PublishContext spends too much on copying
+the options and merging headers for every message. The options are applied
+to a template message once, Send only sets the body of a copy of it. Unlike
+PublishContext, Send doesn't copy the options, merge the default headers or
+start a goroutine watching ctx, and it injects the trace context only if the
+client has tracing set. Encoding and writing the frames still allocates,
+see BenchmarkPublisherSend against BenchmarkPublish.
+
+A Publisher is safe for concurrent use. It must be closed once it is no
+longer needed. Like a Session it does not reconnect, once its channel is
+closed every Send fails and a new Publisher has to be created.
+*/
+type Publisher struct {
+	s             *Session
+	exchange, key string
+	opts          PublishOpts
+	msg           amqp.Publishing
+	wait          bool
+}
+
+/*
+NewPublisher opens a session and returns a Publisher using it.
+
+ctx is the context object that can be used to stop retrying to connect
+
+exchange is the name of exchange where the messages will be published
+
+key is the routing key used for routing the messages
+
+template holds the properties and headers of every message, its Body is
+replaced by Send. Its headers must not be modified while the Publisher is
+in use.
+
+opts is option for publishing the messages. With opts.Confirm or
+opts.Mandatory every Send waits for the confirmation like PublishContext,
+which costs more than the publishing saves.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) NewPublisher(
+	ctx context.Context,
+	exchange, key string,
+	template amqp.Publishing,
+	opts *PublishOpts,
+	connOpts *ConnectOpts) (*Publisher, error) {
+
+	defaultOpts := *DefaultPublishOpts()
+	if opts != nil {
+		defaultOpts = *opts
+	}
+
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	if err := checkTable("headers", template.Headers); err != nil {
+		return nil, err
+	}
+	if err := checkTable("default headers", defaultOpts.DefaultHeaders); err != nil {
+		return nil, err
+	}
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		s:        s,
+		exchange: exchange,
+		key:      key,
+		msg:      defaultOpts.apply(template),
+		wait:     defaultOpts.Confirm || defaultOpts.Mandatory,
+	}
+	// merged into the template already
+	defaultOpts.DefaultHeaders = nil
+	p.opts = defaultOpts
+
+	return p, nil
+}
+
+/*
+Send publishes body with the properties of the template. The trace context
+of ctx is injected into a copy of the headers if the client has tracing set.
+Send fails if ctx is done already, but unlike PublishContext it doesn't
+abandon a write blocked e.g. by flow control once ctx is done, as that costs
+a goroutine per message. Bound such writes with ConnectOpts.WriteTimeout.
+With opts.Confirm or opts.Mandatory Send is PublishContext.
+*/
+func (p *Publisher) Send(ctx context.Context, body []byte) (err error) {
+	msg := p.msg
+	msg.Body = body
+
+	if p.wait {
+		return p.s.PublishContext(ctx, msg, p.exchange, p.key, &p.opts)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if p.s.metrics != nil {
+		defer func(start time.Time) {
+			p.s.onPublish(p.exchange, p.key, err, start)
+		}(time.Now())
+	}
+
+	if p.s.propagator != nil {
+		msg = p.s.inject(ctx, msg)
+	}
+
+	p.s.mu.Lock()
+	_, _, err = p.s.publishApplied(msg, p.exchange, p.key, &p.opts)
+	p.s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("publish to exchange [%s] with key [%s]: %w", p.exchange, p.key, err)
+	}
+	return nil
+}
+
+// Close closes the session of the publisher
+func (p *Publisher) Close() error {
+	return p.s.Close()
+}
@@ -0,0 +1,114 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// benchPublishOpts exercise the per message work of PublishContext:
+// properties filled in from the options and merged default headers
+func benchPublishOpts() *PublishOpts {
+	opts := DefaultPublishOpts()
+	opts.Persistent = true
+	opts.Expiration = time.Minute
+	opts.AppId = "bench"
+	opts.DefaultHeaders = amqp.Table{"source": "bench", "version": int32(1)}
+	return opts
+}
+
+var benchBody = []byte(`{"id":42,"status":"created"}`)
+
+func TestPublisherSend(t *testing.T) {
+	c, connOpts := stubClient(t)
+	c.SetLogger(NopLogger())
+	ctx := context.Background()
+
+	p, err := c.NewPublisher(ctx, "events", "orders.created",
+		amqp.Publishing{ContentType: "application/json"}, benchPublishOpts(), connOpts)
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+
+	if got := p.msg.Headers["source"]; got != "bench" {
+		t.Errorf("template header source = %v, want the default header", got)
+	}
+	if p.msg.DeliveryMode != amqp.Persistent || p.msg.Expiration != "60000" {
+		t.Errorf("template = %+v, want the options applied", p.msg)
+	}
+	if p.opts.DefaultHeaders != nil {
+		t.Errorf("default headers are merged again on every Send")
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := p.Send(ctx, benchBody); err != nil {
+			t.Fatalf("Send #%d: %v", i, err)
+		}
+	}
+	if n := c.Stats().Publishes; n != 10 {
+		t.Errorf("Stats().Publishes = %d, want 10", n)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := p.Send(cancelled, benchBody); err != context.Canceled {
+		t.Errorf("Send with done ctx = %v, want context.Canceled", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := p.Send(ctx, benchBody); err == nil {
+		t.Errorf("Send after Close succeeded")
+	}
+}
+
+// BenchmarkPublish publishes with Session.PublishContext. It uses one
+// session like the Publisher, Client.Publish would measure dialing.
+func BenchmarkPublish(b *testing.B) {
+	c, connOpts := stubClient(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	opts := benchPublishOpts()
+	template := amqp.Publishing{ContentType: "application/json"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := template
+		msg.Body = benchBody
+		if err := s.PublishContext(ctx, msg, "events", "orders.created", opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPublisherSend(b *testing.B) {
+	c, connOpts := stubClient(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := c.NewPublisher(ctx, "events", "orders.created",
+		amqp.Publishing{ContentType: "application/json"}, benchPublishOpts(), connOpts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Send(ctx, benchBody); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
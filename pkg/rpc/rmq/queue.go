@@ -1,7 +1,11 @@
 package rmq
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -32,6 +36,43 @@ to declare, bind, consume, purge or delete a queue with the same name.
 When noWait is true, the queue will assume to be declared on the server. A channel exception
 will arrive if the conditions are met for existing queues or attempting to modify an existing
 queue from a different connection.
+
+DeadLetterExchange and DeadLetterRoutingKey set the x-dead-letter-exchange and
+x-dead-letter-routing-key arguments, so that rejected and expired messages are
+republished to that exchange. An empty DeadLetterRoutingKey keeps the original
+routing key of the message.
+
+MessageTTL, MaxLength and MaxLengthBytes set the x-message-ttl, x-max-length
+and x-max-length-bytes arguments. MessageTTL is sent in whole milliseconds as
+expected by the server. Zero values leave the arguments unset.
+
+Overflow sets x-overflow, what the server does once a queue reaches
+MaxLength or MaxLengthBytes. OverflowDropHead, the server default, discards
+the oldest messages. OverflowRejectPublish rejects new publishings instead,
+publishers in confirm mode get ErrPublishNacked, and
+OverflowRejectPublishDLX also dead-letters them. Quorum queues don't support
+OverflowRejectPublishDLX. Other values fail with ErrInvalidQueueOpts before
+anything is sent to the server.
+
+Lazy sets x-queue-mode to lazy, so that messages are moved to disk as early
+as possible and kept in memory only when requested by consumers. It suits
+queues which build up large backlogs while consumers are away.
+
+MaxPriority sets x-max-priority, making the queue a priority queue which
+delivers messages with a higher Priority first. RabbitMQ recommends values
+up to 10. Publish with PublishOpts.Priority or amqp.Publishing.Priority.
+
+SingleActiveConsumer sets x-single-active-consumer, so that the server
+delivers to one consumer of the queue at a time and fails over to the next
+one when it goes away, which keeps the messages in order across replicas.
+The argument can't be changed for an existing queue.
+
+QueueType sets x-queue-type, e.g. QueueQuorum for replicated quorum queues.
+Quorum queues and streams are always durable and can be neither exclusive
+nor auto-deleted, declaring them with such options fails with
+ErrInvalidQueueOpts before anything is sent to the server.
+
+Keys already present in Args take precedence over all these fields.
 */
 type DeclareQueueOpts struct {
 	Durable    bool       // default true
@@ -39,6 +80,76 @@ type DeclareQueueOpts struct {
 	Exclusive  bool       // default false
 	NoWait     bool       // default false
 	Args       amqp.Table // default nil
+
+	DeadLetterExchange   string // default ""
+	DeadLetterRoutingKey string // default ""
+
+	MessageTTL     time.Duration // default 0
+	MaxLength      int           // default 0
+	MaxLengthBytes int           // default 0
+	Lazy           bool          // default false
+	MaxPriority    uint8         // default 0
+	Overflow       string        // default "" uses the server default, drop-head
+
+	SingleActiveConsumer bool   // default false
+	QueueType            string // default "" uses the server default, classic
+}
+
+// Queue types for DeclareQueueOpts.QueueType
+const (
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum"
+	QueueStream  = "stream"
+)
+
+// Overflow behaviours for DeclareQueueOpts.Overflow
+const (
+	OverflowDropHead         = "drop-head"
+	OverflowRejectPublish    = "reject-publish"
+	OverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+// ErrInvalidQueueOpts is returned when declaring a queue
+// with options the server would reject
+var ErrInvalidQueueOpts = errors.New("invalid queue options")
+
+// validate checks the options before declaring, so that invalid
+// combinations fail with a clear error instead of a channel exception
+func (o *DeclareQueueOpts) validate() error {
+	if err := checkTable("args", o.Args); err != nil {
+		return err
+	}
+
+	switch o.Overflow {
+	case "", OverflowDropHead, OverflowRejectPublish:
+	case OverflowRejectPublishDLX:
+		if o.QueueType == QueueQuorum {
+			return fmt.Errorf("%w: %s queues don't support overflow [%s]",
+				ErrInvalidQueueOpts, o.QueueType, o.Overflow)
+		}
+	default:
+		return fmt.Errorf("%w: unknown overflow [%s], must be one of %s, %s or %s",
+			ErrInvalidQueueOpts, o.Overflow, OverflowDropHead, OverflowRejectPublish, OverflowRejectPublishDLX)
+	}
+
+	switch o.QueueType {
+	case "", QueueClassic:
+		return nil
+	case QueueQuorum, QueueStream:
+	default:
+		return fmt.Errorf("%w: unknown queue type [%s], must be one of %s, %s or %s",
+			ErrInvalidQueueOpts, o.QueueType, QueueClassic, QueueQuorum, QueueStream)
+	}
+
+	switch {
+	case !o.Durable:
+		return fmt.Errorf("%w: %s queues must be durable", ErrInvalidQueueOpts, o.QueueType)
+	case o.Exclusive:
+		return fmt.Errorf("%w: %s queues can't be exclusive", ErrInvalidQueueOpts, o.QueueType)
+	case o.AutoDelete:
+		return fmt.Errorf("%w: %s queues can't be auto-deleted", ErrInvalidQueueOpts, o.QueueType)
+	}
+	return nil
 }
 
 // DefaultDeclareQueueOpts ...
@@ -66,60 +177,455 @@ func (c *Client) QueueDeclare(
 	name string,
 	opts *DeclareQueueOpts,
 	connOpts *ConnectOpts) (amqp.Queue, error) {
+
+	return c.QueueDeclareContext(context.Background(), name, opts, connOpts)
+}
+
+// QueueDeclareContext is like QueueDeclare but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueDeclareContext(
+	ctx context.Context,
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (amqp.Queue, error) {
+
+	if opts != nil {
+		if err := opts.validate(); err != nil {
+			return amqp.Queue{}, fmt.Errorf("declare queue [%s]: %w", name, err)
+		}
+	}
+
+	var q amqp.Queue
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		q, err = s.QueueDeclare(name, opts)
+		return err
+	})
+	return q, err
+}
+
+// QueueDeclare declares a queue on the session channel,
+// see Client.QueueDeclare
+func (s *Session) QueueDeclare(name string, opts *DeclareQueueOpts) (amqp.Queue, error) {
 	defaultOpts := DefaultDeclareQueueOpts()
 
 	if opts != nil {
 		defaultOpts = opts
 	}
 
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
+	if err := defaultOpts.validate(); err != nil {
+		return amqp.Queue{}, fmt.Errorf("declare queue [%s]: %w", name, err)
 	}
 
-	var q amqp.Queue
+	q, err := s.ch.QueueDeclare(
+		name,
+		defaultOpts.Durable,
+		defaultOpts.AutoDelete,
+		defaultOpts.Exclusive,
+		defaultOpts.NoWait,
+		defaultOpts.args(),
+	)
+	if err != nil {
+		// the server closes the channel with 406 if the
+		// queue exists with other options or arguments
+		if IsPreconditionFailed(err) {
+			return q, fmt.Errorf("queue [%s] exists with different options: %w", name, err)
+		}
+		return q, fmt.Errorf("declare queue [%s]: %w", name, err)
+	}
+
+	return q, nil
+}
+
+// QueueStats is the state of a queue as reported by the server
+// when declaring or inspecting it
+type QueueStats struct {
+	Name      string // Name of the queue, generated by the server if declared without one
+	Messages  int    // Number of messages ready for delivery, not counting unacked ones
+	Consumers int    // Number of consumers
+}
+
+func queueStats(q amqp.Queue) QueueStats {
+	return QueueStats{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers}
+}
+
+// IsEmpty reports whether the queue had no messages ready for delivery
+func (q QueueStats) IsEmpty() bool {
+	return q.Messages == 0
+}
+
+// HasConsumers reports whether anyone consumed from the queue
+func (q QueueStats) HasConsumers() bool {
+	return q.Consumers > 0
+}
+
+// QueueDeclareStats is like QueueDeclare but returns the state
+// of the queue as QueueStats
+func (c *Client) QueueDeclareStats(
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (QueueStats, error) {
+
+	return c.QueueDeclareStatsContext(context.Background(), name, opts, connOpts)
+}
+
+// QueueDeclareStatsContext is like QueueDeclareStats but stops
+// retrying to connect as soon as ctx is done
+func (c *Client) QueueDeclareStatsContext(
+	ctx context.Context,
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (QueueStats, error) {
+
+	q, err := c.QueueDeclareContext(ctx, name, opts, connOpts)
+	if err != nil {
+		return QueueStats{}, err
+	}
+	return queueStats(q), nil
+}
+
+/*
+QueueDeclareExclusive declares a server named exclusive queue, e.g. for
+replies, and returns it along with the session owning it. An exclusive queue
+is deleted by the server once the connection declaring it closes and can't
+be used from other connections, so use the returned session to consume from
+it and close the session once the queue is no longer needed.
+
+For a pooled client the connection is shared, the queue is then only deleted
+once the pool closes that connection.
 
-	conn, err := c.connect(defaultConnOpts)
+ctx is the context object that can be used to stop retrying to connect
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) QueueDeclareExclusive(ctx context.Context, connOpts *ConnectOpts) (*Session, amqp.Queue, error) {
+	s, err := c.OpenSessionContext(ctx, connOpts)
 	if err != nil {
-		return q, err
+		return nil, amqp.Queue{}, err
 	}
-	defer conn.Close()
 
-	ch, err := conn.Channel()
+	q, err := s.QueueDeclare("", &DeclareQueueOpts{
+		Durable:    false,
+		AutoDelete: true,
+		Exclusive:  true,
+	})
 	if err != nil {
-		return q, err
+		s.Close()
+		return nil, amqp.Queue{}, err
 	}
-	defer ch.Close()
 
-	q, err = ch.QueueDeclare(
+	return s, q, nil
+}
+
+/*
+QueueDeclarePassive checks that a queue exists on the RabbitMQ server without
+declaring it, e.g. to verify the topology with credentials which are not
+allowed to declare queues
+
+name is the name of queue
+
+opts is the options the queue is expected to be declared with
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+If the queue does not exist the returned error satisfies IsNotFound. The
+server does not compare Durable, AutoDelete or Args of a passive declaration,
+so only declaring with QueueDeclare tells whether those match. An error
+satisfying IsPreconditionFailed is returned by QueueDeclare then, deleting
+and declaring the queue again resolves it at the cost of its messages.
+*/
+func (c *Client) QueueDeclarePassive(
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (amqp.Queue, error) {
+
+	return c.QueueDeclarePassiveContext(context.Background(), name, opts, connOpts)
+}
+
+// QueueDeclarePassiveContext is like QueueDeclarePassive but stops
+// retrying to connect as soon as ctx is done
+func (c *Client) QueueDeclarePassiveContext(
+	ctx context.Context,
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (amqp.Queue, error) {
+
+	var q amqp.Queue
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		q, err = s.QueueDeclarePassive(name, opts)
+		return err
+	})
+	return q, err
+}
+
+// QueueDeclarePassive checks that a queue exists using the session
+// channel, see Client.QueueDeclarePassive
+func (s *Session) QueueDeclarePassive(name string, opts *DeclareQueueOpts) (amqp.Queue, error) {
+	defaultOpts := DefaultDeclareQueueOpts()
+
+	if opts != nil {
+		defaultOpts = opts
+	}
+
+	q, err := s.ch.QueueDeclarePassive(
 		name,
 		defaultOpts.Durable,
 		defaultOpts.AutoDelete,
 		defaultOpts.Exclusive,
 		defaultOpts.NoWait,
-		defaultOpts.Args,
+		defaultOpts.args(),
 	)
 	if err != nil {
-		return q, err
+		if IsNotFound(err) {
+			return q, fmt.Errorf("queue [%s] does not exist: %w", name, err)
+		}
+		return q, fmt.Errorf("declare queue [%s] passively: %w", name, err)
+	}
+
+	return q, nil
+}
+
+/*
+QueueDeclareOrGet returns an existing queue as it is and only declares it if
+it doesn't exist, so that a queue created by someone else with other options
+or arguments is used instead of failing with PRECONDITION_FAILED like
+QueueDeclare does. created reports whether the queue was declared.
+
+The server closes the channel when a passive declaration finds no queue, so
+the queue is declared on a new channel. If the queue is created by someone
+else meanwhile and the declaration fails with PRECONDITION_FAILED, the queue
+is fetched again.
+
+ctx is the context object that can be used to stop retrying to connect
+
+name is the name of queue
+
+opts is the options for declaring the queue if it doesn't exist
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) QueueDeclareOrGet(
+	ctx context.Context,
+	name string,
+	opts *DeclareQueueOpts,
+	connOpts *ConnectOpts) (q amqp.Queue, created bool, err error) {
+
+	q, err = c.QueueDeclarePassiveContext(ctx, name, opts, connOpts)
+	if !IsNotFound(err) {
+		return q, false, err
+	}
+
+	q, err = c.QueueDeclareContext(ctx, name, opts, connOpts)
+	if IsPreconditionFailed(err) {
+		q, err = c.QueueDeclarePassiveContext(ctx, name, opts, connOpts)
+		return q, false, err
+	}
+	return q, err == nil, err
+}
+
+// args returns Args merged with the arguments of the convenience fields,
+// Args itself is not modified
+func (o *DeclareQueueOpts) args() amqp.Table {
+	args := amqp.Table{}
+	if o.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = o.DeadLetterExchange
+	}
+	if o.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = o.DeadLetterRoutingKey
+	}
+	if o.MessageTTL > 0 {
+		args["x-message-ttl"] = int64(o.MessageTTL / time.Millisecond)
+	}
+	if o.MaxLength > 0 {
+		args["x-max-length"] = int64(o.MaxLength)
+	}
+	if o.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = int64(o.MaxLengthBytes)
+	}
+	if o.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	if o.MaxPriority > 0 {
+		args["x-max-priority"] = int64(o.MaxPriority)
+	}
+	if o.Overflow != "" {
+		args["x-overflow"] = o.Overflow
+	}
+	if o.SingleActiveConsumer {
+		args["x-single-active-consumer"] = true
+	}
+	if o.QueueType != "" {
+		args["x-queue-type"] = o.QueueType
+	}
+
+	if len(args) == 0 {
+		return o.Args
+	}
+
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	return args
+}
+
+/*
+QueueInspect returns the current state of a queue on the RabbitMQ server,
+including the number of messages ready for delivery and the number of
+consumers, without declaring it
+
+name is the name of the queue
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) QueueInspect(name string, connOpts *ConnectOpts) (amqp.Queue, error) {
+	return c.QueueInspectContext(context.Background(), name, connOpts)
+}
+
+// QueueInspectContext is like QueueInspect but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueInspectContext(
+	ctx context.Context,
+	name string,
+	connOpts *ConnectOpts) (amqp.Queue, error) {
+
+	var q amqp.Queue
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		q, err = s.QueueInspect(name)
+		return err
+	})
+	return q, err
+}
+
+// QueueInspect returns the current state of a queue using the
+// session channel, see Client.QueueInspect
+func (s *Session) QueueInspect(name string) (amqp.Queue, error) {
+	q, err := s.ch.QueueInspect(name)
+	if err != nil {
+		// the server closes the channel with 404 for unknown queues
+		if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return q, fmt.Errorf("queue [%s] does not exist: %w", name, err)
+		}
+		return q, fmt.Errorf("inspect queue [%s]: %w", name, err)
 	}
 
 	return q, nil
 }
 
-// QueueBindOpts ...
+/*
+QueueBindOpts ...
+
+Headers and Match bind to a headers exchange, which routes on the headers of
+a message instead of the routing key. Match is "all" (the default) if every
+header has to match or "any" if one matching header is enough, the variants
+"all-with-x" and "any-with-x" also consider headers starting with "x-".
+Headers and Match take precedence over the same keys in Args.
+
+ExchangeKind is the kind the exchange was declared with, e.g.
+amqp.ExchangeFanout. The server doesn't tell the kind of an exchange, so
+when it is set the binding is checked against it for obvious mistakes: a
+routing key for a fanout or headers exchange, which ignore it, wildcards in
+the key of a direct exchange, which matches them literally, topic keys
+ValidateTopicPattern rejects, e.g. with empty words or "*" or "#" within a
+word, and headers for any exchange but a headers exchange. Mistakes are
+logged, or fail with ErrInvalidBinding before anything is sent to the server
+when Strict is set.
+*/
 type QueueBindOpts struct {
 	NoWait bool       // default false
 	Args   amqp.Table // default nil
+
+	Match   string                 // default "" uses the server default "all"
+	Headers map[string]interface{} // default nil
+
+	ExchangeKind string // Kind of the exchange to check the binding against, default ""
+	Strict       bool   // Fail instead of logging mistakes, default false
 }
 
 // DefaultQueueBindOpts ...
 func DefaultQueueBindOpts() *QueueBindOpts {
 	return &QueueBindOpts{
-		NoWait: false,
-		Args:   nil,
+		NoWait:  false,
+		Args:    nil,
+		Match:   "",
+		Headers: nil,
+
+		ExchangeKind: "",
+		Strict:       false,
 	}
 }
 
+// ErrInvalidBinding is returned by QueueBind with QueueBindOpts.Strict
+// for a binding which doesn't fit the kind of the exchange
+var ErrInvalidBinding = errors.New("invalid binding")
+
+// checkKind returns ErrInvalidBinding if binding with key doesn't
+// fit ExchangeKind, or nil if it fits or ExchangeKind is unset
+func (o *QueueBindOpts) checkKind(key string) error {
+	invalid := func(format string, v ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidBinding, fmt.Sprintf(format, v...))
+	}
+
+	switch o.ExchangeKind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic:
+		if o.Match != "" || len(o.Headers) > 0 {
+			return invalid("only headers exchanges route on headers, not %s exchanges", o.ExchangeKind)
+		}
+	}
+
+	switch o.ExchangeKind {
+	case amqp.ExchangeFanout, amqp.ExchangeHeaders:
+		if key != "" {
+			return invalid("%s exchanges ignore the routing key [%s]", o.ExchangeKind, key)
+		}
+	case amqp.ExchangeDirect:
+		for _, word := range strings.Split(key, ".") {
+			if word == "*" || word == "#" {
+				return invalid("direct exchanges match the wildcards of [%s] literally, "+
+					"declare a topic exchange", key)
+			}
+		}
+	case amqp.ExchangeTopic:
+		return ValidateTopicPattern(key)
+	}
+	return nil
+}
+
+// args returns Args merged with Headers and Match,
+// Args itself is not modified
+func (o *QueueBindOpts) args() (amqp.Table, error) {
+	switch o.Match {
+	case "", "all", "any", "all-with-x", "any-with-x":
+	default:
+		return nil, fmt.Errorf("invalid x-match [%s], must be one of all, any, all-with-x or any-with-x", o.Match)
+	}
+
+	if err := checkTable("args", o.Args); err != nil {
+		return nil, err
+	}
+	if err := checkTable("headers", o.Headers); err != nil {
+		return nil, err
+	}
+
+	if o.Match == "" && len(o.Headers) == 0 {
+		return o.Args, nil
+	}
+
+	args := amqp.Table{}
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	for k, v := range o.Headers {
+		args[k] = v
+	}
+	if o.Match != "" {
+		args["x-match"] = o.Match
+	}
+	return args, nil
+}
+
 /*
 QueueBind binds a queue to an exchange with provided routing key on the RabbitMQ server
 
@@ -139,43 +645,192 @@ func (c *Client) QueueBind(
 	opts *QueueBindOpts,
 	connOpts *ConnectOpts) error {
 
-	defaultOpts := DefaultQueueBindOpts()
+	return c.QueueBindContext(context.Background(), exchange, queue, key, opts, connOpts)
+}
+
+// QueueBindContext is like QueueBind but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueBindContext(
+	ctx context.Context,
+	exchange, queue, key string,
+	opts *QueueBindOpts,
+	connOpts *ConnectOpts) error {
 
+	// fail on invalid options before connecting
 	if opts != nil {
-		defaultOpts = opts
+		if _, err := opts.args(); err != nil {
+			return err
+		}
+		if opts.Strict {
+			if err := opts.checkKind(key); err != nil {
+				return err
+			}
+		}
 	}
 
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.QueueBind(exchange, queue, key, opts)
+	})
+}
+
+// QueueBind binds a queue to an exchange using the session channel,
+// see Client.QueueBind
+func (s *Session) QueueBind(exchange, queue, key string, opts *QueueBindOpts) error {
+	if err := s.queueBind(exchange, queue, key, opts); err != nil {
+		return fmt.Errorf("bind queue [%s] to exchange [%s] with key [%s]: %w",
+			queue, exchange, key, err)
 	}
+	return nil
+}
 
-	conn, err := c.connect(defaultConnOpts)
-	if err != nil {
-		return err
+func (s *Session) queueBind(exchange, queue, key string, opts *QueueBindOpts) error {
+	defaultOpts := DefaultQueueBindOpts()
+
+	if opts != nil {
+		defaultOpts = opts
 	}
-	defer conn.Close()
 
-	ch, err := conn.Channel()
+	args, err := defaultOpts.args()
 	if err != nil {
 		return err
 	}
-	defer ch.Close()
+	if err = checkKey(key); err != nil {
+		return err
+	}
+	if err = defaultOpts.checkKind(key); err != nil {
+		if defaultOpts.Strict {
+			return err
+		}
+		s.logger.Printf("Binding queue [%s] to exchange [%s]: %s\n", queue, exchange, err.Error())
+	}
 
-	err = ch.QueueBind(
+	return s.ch.QueueBind(
 		queue,
 		key,
 		exchange,
 		defaultOpts.NoWait,
-		defaultOpts.Args,
+		args,
 	)
-	if err != nil {
-		return err
+}
+
+/*
+QueueBindMany binds a queue to an exchange with every key of keys on a
+single channel
+
+exchange name to bind with the queue
+
+queue name to bind with the exchange
+
+keys used for routing messages on exchange to the queue
+
+opts providing queue binding options, used for every binding
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+If a binding fails the error names its key, the bindings made before are
+left in place and the remaining keys are not bound.
+*/
+func (c *Client) QueueBindMany(
+	exchange, queue string,
+	keys []string,
+	opts *QueueBindOpts,
+	connOpts *ConnectOpts) error {
+
+	return c.QueueBindManyContext(context.Background(), exchange, queue, keys, opts, connOpts)
+}
+
+// QueueBindManyContext is like QueueBindMany but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueBindManyContext(
+	ctx context.Context,
+	exchange, queue string,
+	keys []string,
+	opts *QueueBindOpts,
+	connOpts *ConnectOpts) error {
+
+	// fail on invalid options before connecting
+	if opts != nil {
+		if _, err := opts.args(); err != nil {
+			return err
+		}
+		if opts.Strict {
+			for _, key := range keys {
+				if err := opts.checkKind(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.QueueBindMany(exchange, queue, keys, opts)
+	})
+}
+
+// QueueBindMany binds a queue to an exchange with every key of keys
+// using the session channel, see Client.QueueBindMany
+func (s *Session) QueueBindMany(exchange, queue string, keys []string, opts *QueueBindOpts) error {
+	for _, key := range keys {
+		// the error names the key
+		if err := s.QueueBind(exchange, queue, key, opts); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+/*
+QueueUnbind removes a binding between an exchange and a queue matching the
+routing key and arguments. The queue keeps its messages and other bindings.
+
+exchange name the queue is bound to
+
+queue name to unbind from the exchange
+
+key used when the binding was declared
+
+args used when the binding was declared
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) QueueUnbind(
+	exchange, queue, key string,
+	args amqp.Table,
+	connOpts *ConnectOpts) error {
+
+	return c.QueueUnbindContext(context.Background(), exchange, queue, key, args, connOpts)
+}
+
+// QueueUnbindContext is like QueueUnbind but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueUnbindContext(
+	ctx context.Context,
+	exchange, queue, key string,
+	args amqp.Table,
+	connOpts *ConnectOpts) error {
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.QueueUnbind(exchange, queue, key, args)
+	})
+}
+
+// QueueUnbind removes a binding between an exchange and a queue
+// using the session channel, see Client.QueueUnbind
+func (s *Session) QueueUnbind(exchange, queue, key string, args amqp.Table) error {
+	err := checkTable("args", args)
+	if err == nil {
+		err = s.ch.QueueUnbind(queue, key, exchange, args)
+	}
+	if err != nil {
+		return fmt.Errorf("unbind queue [%s] from exchange [%s] with key [%s]: %w",
+			queue, exchange, key, err)
+	}
+	return nil
+}
+
 // QueueDeleteOpts ...
 type QueueDeleteOpts struct {
 	IfUnused bool // default false
@@ -191,7 +846,8 @@ func DefaultQueueDeleteOpts() *QueueDeleteOpts {
 }
 
 /*
-QueueDelete deletes a queue from the server
+QueueDelete deletes a queue from the server and returns the number of
+messages it still held
 
 queue name that you want to delete
 
@@ -203,47 +859,53 @@ closes or fails and number of retries to attempt.
 func (c *Client) QueueDelete(
 	queue string,
 	opts *QueueDeleteOpts,
-	connOpts *ConnectOpts) error {
+	connOpts *ConnectOpts) (int, error) {
 
-	defaultOpts := DefaultQueueDeleteOpts()
-
-	if opts != nil {
-		defaultOpts = opts
-	}
+	return c.QueueDeleteContext(context.Background(), queue, opts, connOpts)
+}
 
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
-	}
+// QueueDeleteContext is like QueueDelete but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueueDeleteContext(
+	ctx context.Context,
+	queue string,
+	opts *QueueDeleteOpts,
+	connOpts *ConnectOpts) (int, error) {
 
-	conn, err := c.connect(defaultConnOpts)
-	if err != nil {
+	var n int
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		n, err = s.QueueDelete(queue, opts)
 		return err
-	}
-	defer conn.Close()
+	})
+	return n, err
+}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		return err
+// QueueDelete deletes a queue using the session channel,
+// see Client.QueueDelete
+func (s *Session) QueueDelete(queue string, opts *QueueDeleteOpts) (int, error) {
+	defaultOpts := DefaultQueueDeleteOpts()
+
+	if opts != nil {
+		defaultOpts = opts
 	}
-	defer ch.Close()
 
-	num, err := ch.QueueDelete(
+	num, err := s.ch.QueueDelete(
 		queue,
 		defaultOpts.IfUnused,
 		defaultOpts.IfEmpty,
 		defaultOpts.NoWait,
 	)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("delete queue [%s]: %w", queue, err)
 	}
-	log.Printf("Queue [%s] deleted. %d messages purged.\n", queue, num)
+	s.logger.Printf("Queue [%s] deleted. %d messages purged.\n", queue, num)
 
-	return nil
+	return num, nil
 }
 
 /*
-QueuePurge purges messages from the queue
+QueuePurge purges messages from the queue and returns the number of
+messages purged
 
 name is the name of the queue that needs to be purged of messages
 
@@ -253,29 +915,34 @@ the number of messages purged will not be meaningful.
 connOpts provides connection options such as retry to connect if connection
 closes or fails and number of retries to attempt.
 */
-func (c *Client) QueuePurge(queue string, noWait bool, connOpts *ConnectOpts) error {
-	defaultConnOpts := DefaultConnectOpts()
-	if connOpts != nil {
-		defaultConnOpts = connOpts
-	}
+func (c *Client) QueuePurge(queue string, noWait bool, connOpts *ConnectOpts) (int, error) {
+	return c.QueuePurgeContext(context.Background(), queue, noWait, connOpts)
+}
 
-	conn, err := c.connect(defaultConnOpts)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
+// QueuePurgeContext is like QueuePurge but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) QueuePurgeContext(
+	ctx context.Context,
+	queue string,
+	noWait bool,
+	connOpts *ConnectOpts) (int, error) {
 
-	ch, err := conn.Channel()
-	if err != nil {
+	var n int
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		n, err = s.QueuePurge(queue, noWait)
 		return err
-	}
-	defer ch.Close()
+	})
+	return n, err
+}
 
-	num, err := ch.QueuePurge(queue, noWait)
+// QueuePurge purges messages from the queue using the session channel,
+// see Client.QueuePurge
+func (s *Session) QueuePurge(queue string, noWait bool) (int, error) {
+	num, err := s.ch.QueuePurge(queue, noWait)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("purge queue [%s]: %w", queue, err)
 	}
-	log.Printf("%d messages purged from queue [%s].\n", num, queue)
+	s.logger.Printf("%d messages purged from queue [%s].\n", num, queue)
 
-	return nil
+	return num, nil
 }
@@ -0,0 +1,162 @@
+package rmq
+
+import (
+	"context"
+	"math"
+
+	"github.com/streadway/amqp"
+)
+
+// retryCountHeader counts how often Subscribe republished a
+// message after the handler failed on it
+const retryCountHeader = "x-retry-count"
+
+// The exchange and routing key a message was first published with, kept
+// when Subscribe republishes it to the back of its queue
+const (
+	originalExchangeHeader = "x-original-exchange"
+	originalKeyHeader      = "x-original-routing-key"
+)
+
+// withOriginalRouting returns msg with the exchange and routing key it was
+// first published with if it is a copy redeliver republished to queue
+// through the default exchange, so that handlers, e.g. a Router, see it
+// like the original. This includes copies quarantined that way.
+func withOriginalRouting(msg amqp.Delivery, queue string) amqp.Delivery {
+	if msg.Exchange != "" || msg.RoutingKey != queue {
+		return msg
+	}
+
+	exchange, ok := msg.Headers[originalExchangeHeader].(string)
+	key, hasKey := msg.Headers[originalKeyHeader].(string)
+	if ok && hasKey {
+		msg.Exchange, msg.RoutingKey = exchange, key
+	}
+	return msg
+}
+
+/*
+deliveryCount returns how often msg was delivered from queue before, i.e.
+the x-retry-count header set when republishing it plus the number of times
+RabbitMQ dead-lettered it from queue according to the x-death header, e.g.
+when retrying through a dead letter exchange with a TTL.
+*/
+func deliveryCount(msg amqp.Delivery, queue string) int64 {
+	count := toInt64(msg.Headers[retryCountHeader])
+
+	deaths, _ := msg.Headers["x-death"].([]interface{})
+	for _, d := range deaths {
+		death, ok := d.(amqp.Table)
+		if ok && death["queue"] == queue {
+			count += toInt64(death["count"])
+		}
+	}
+	return count
+}
+
+// toInt64 returns the numeric header value v, or 0 if it is none. Floats
+// are truncated and unsigned values beyond math.MaxInt64 are capped.
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint:
+		return toInt64(uint64(n))
+	case uint64:
+		if n > math.MaxInt64 {
+			return math.MaxInt64
+		}
+		return int64(n)
+	case float32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+// republishing returns a copy of msg for publishing it again with the
+// retry count set to retries. The exchange and routing key of msg are kept
+// in headers unless they were kept by an earlier attempt already.
+func republishing(msg amqp.Delivery, retries int64) amqp.Publishing {
+	headers := withHeader(msg.Headers, retryCountHeader, retries)
+	if _, ok := headers[originalKeyHeader]; !ok {
+		headers[originalExchangeHeader] = msg.Exchange
+		headers[originalKeyHeader] = msg.RoutingKey
+	}
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+// redeliver settles msg, which the handler failed on, once
+// opts.MaxRedeliveries is set. The message is republished to the back of
+// queue with an incremented retry count or, once it was delivered
+// MaxRedeliveries times, quarantined. msg is acked only once the server
+// confirmed the copy, else it is requeued as it is.
+func (s *Session) redeliver(queue string, msg amqp.Delivery, opts *SubscribeOpts) error {
+	count := deliveryCount(msg, queue)
+
+	exchange, key, retries := "", queue, count+1
+	if count >= int64(opts.MaxRedeliveries) {
+		if opts.QuarantineExchange == "" && opts.QuarantineKey == "" {
+			msg.Nack(false, false) // dead-lettered if the queue has a DLX
+			s.onNack(queue, false)
+			return nil
+		}
+		exchange, key, retries = opts.QuarantineExchange, opts.QuarantineKey, count
+	}
+
+	if err := s.republish(exchange, key, republishing(msg, retries)); err != nil {
+		msg.Nack(false, true)
+		s.onNack(queue, true)
+		return err
+	}
+	msg.Ack(false)
+	s.onAck(queue)
+	return nil
+}
+
+// republish publishes msg and waits until the server confirmed it. It puts
+// the session channel into confirm mode.
+func (s *Session) republish(exchange, key string, msg amqp.Publishing) error {
+	opts := DefaultPublishOpts()
+	opts.Confirm = true
+
+	s.mu.Lock()
+	tag, done, err := s.publish(msg, exchange, key, opts)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.confirms.waitConfirm(context.Background(), tag, done, opts.ConfirmTimeout)
+}
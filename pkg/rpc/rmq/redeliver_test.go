@@ -0,0 +1,189 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want int64
+	}{
+		{int8(3), 3},
+		{int16(3), 3},
+		{int32(3), 3},
+		{int64(3), 3},
+		{int(3), 3},
+		{uint8(3), 3},
+		{uint16(3), 3},
+		{uint32(3), 3},
+		{uint(3), 3},
+		{uint64(3), 3},
+		{uint64(math.MaxUint64), math.MaxInt64},
+		{float32(3.9), 3},
+		{float64(3.9), 3},
+		{"3", 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := toInt64(tt.v); got != tt.want {
+			t.Errorf("toInt64(%T(%v)) = %d, want %d", tt.v, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryCount(t *testing.T) {
+	msg := amqp.Delivery{Headers: amqp.Table{
+		retryCountHeader: int32(2),
+		"x-death": []interface{}{
+			amqp.Table{"queue": "orders", "count": int64(3)},
+			amqp.Table{"queue": "other", "count": int64(5)},
+		},
+	}}
+
+	if got := deliveryCount(msg, "orders"); got != 5 {
+		t.Errorf("deliveryCount = %d, want 5", got)
+	}
+	if got := deliveryCount(amqp.Delivery{}, "orders"); got != 0 {
+		t.Errorf("deliveryCount without headers = %d, want 0", got)
+	}
+}
+
+// settleCounter counts the settled deliveries reported to a MetricsHook
+type settleCounter struct {
+	mu          sync.Mutex
+	acks, nacks int
+}
+
+func (m *settleCounter) OnPublish(exchange, key string, err error, dur time.Duration) {}
+func (m *settleCounter) OnDeliver(queue string)                                       {}
+func (m *settleCounter) OnReconnect()                                                 {}
+
+func (m *settleCounter) OnAck(queue string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acks++
+}
+
+func (m *settleCounter) OnNack(queue string, requeue bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nacks++
+}
+
+/*
+TestRedeliverAndQuarantine fails on a message routed to a Router through an
+exchange until Subscribe quarantines it. Every retry must reach the route
+of the original routing key, each failed delivery must be acked once its
+copy was confirmed and the last copy must end up in the quarantine queue.
+*/
+func TestRedeliverAndQuarantine(t *testing.T) {
+	c, connOpts := stubClient(t)
+	c.SetLogger(NopLogger())
+	broker := newStubBroker()
+	connOpts.Config = broker.config()
+	metrics := &settleCounter{}
+	c.SetMetricsHook(metrics)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, name := range []string{"orders", "orders.poison"} {
+		if _, err := c.QueueDeclare(name, nil, connOpts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.QueueBind("events", "orders", "orders.created", nil, connOpts); err != nil {
+		t.Fatal(err)
+	}
+	msg := amqp.Publishing{Body: []byte(`{"id":42}`), MessageId: "order-42"}
+	if err := c.Publish(msg, "events", "orders.created", nil, connOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	const maxRedeliveries = 2
+	var deliveries []amqp.Delivery
+	router := &Router{Routes: map[string]Handler{
+		"orders.*": func(_ context.Context, msg amqp.Delivery) (amqp.Publishing, error) {
+			deliveries = append(deliveries, msg) // one worker
+			return amqp.Publishing{}, errors.New("payment service down")
+		},
+	}}
+
+	opts := DefaultSubscribeOpts()
+	opts.ListenIndefinitely = true
+	opts.ContinueOnError = true
+	opts.MaxRedeliveries = maxRedeliveries
+	opts.QuarantineKey = "orders.poison"
+
+	ctx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SubscribeHandler(ctx, "orders", opts, nil, connOpts, router.Handle)
+	}()
+
+	for len(broker.queued("orders.poison")) == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	if err := <-done; err != nil {
+		t.Fatalf("SubscribeHandler: %v", err)
+	}
+
+	if len(deliveries) != maxRedeliveries+1 {
+		t.Fatalf("handler got %d deliveries, want the first and %d retries", len(deliveries), maxRedeliveries)
+	}
+	for i, d := range deliveries {
+		if d.Exchange != "events" || d.RoutingKey != "orders.created" {
+			t.Errorf("delivery #%d from exchange %q with key %q, want the original events and orders.created",
+				i, d.Exchange, d.RoutingKey)
+		}
+		if got := toInt64(d.Headers[retryCountHeader]); got != int64(i) {
+			t.Errorf("delivery #%d has retry count %d, want %d", i, got, i)
+		}
+		if d.MessageId != "order-42" || string(d.Body) != `{"id":42}` {
+			t.Errorf("delivery #%d = %+v, want a copy of the message", i, d)
+		}
+	}
+
+	acks, nacks := broker.settled()
+	if acks != maxRedeliveries+1 || nacks != 0 {
+		t.Errorf("broker got %d acks and %d nacks, want every failed delivery acked once its copy was confirmed",
+			acks, nacks)
+	}
+	if metrics.acks != maxRedeliveries+1 || metrics.nacks != 0 {
+		t.Errorf("metrics counted %d acks and %d nacks, want %d acks", metrics.acks, metrics.nacks, maxRedeliveries+1)
+	}
+	if n := len(broker.queued("orders")); n != 0 {
+		t.Errorf("%d messages left in the queue, want none", n)
+	}
+
+	// the quarantined copy is handed out like a retried one
+	var quarantined amqp.Delivery
+	err := c.Subscribe(context.Background(), "orders.poison", DefaultSubscribeOpts(), nil, connOpts,
+		func(msg amqp.Delivery) (amqp.Publishing, error) {
+			quarantined = msg
+			return amqp.Publishing{}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quarantined.Exchange != "events" || quarantined.RoutingKey != "orders.created" {
+		t.Errorf("quarantined copy from exchange %q with key %q, want the original events and orders.created",
+			quarantined.Exchange, quarantined.RoutingKey)
+	}
+	if got := toInt64(quarantined.Headers[retryCountHeader]); got != maxRedeliveries {
+		t.Errorf("quarantined copy has retry count %d, want %d", got, maxRedeliveries)
+	}
+	if quarantined.Headers[originalExchangeHeader] != "events" ||
+		quarantined.Headers[originalKeyHeader] != "orders.created" {
+		t.Errorf("quarantined copy headers = %v, want the original exchange and routing key", quarantined.Headers)
+	}
+}
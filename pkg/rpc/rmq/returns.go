@@ -0,0 +1,58 @@
+package rmq
+
+import (
+	"github.com/streadway/amqp"
+)
+
+/*
+OnReturn sets the function receiving every publishing the server returned
+because it could not be routed, e.g. to log or re-route messages published to
+an exchange without a matching binding. nil (the default) disables it.
+Sessions already open keep the previous function.
+
+Only publishings sent with PublishOpts.Mandatory are returned. fn is called
+in addition to the publish failing with a *ReturnError, so that long-lived
+publishers can handle returns in one place.
+
+fn is called from the goroutine receiving the confirmations of the channel
+and must return quickly. It must not publish on the session of the returned
+publishing, re-route from another goroutine instead.
+*/
+func (c *Client) OnReturn(fn func(amqp.Return)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onReturn = fn
+}
+
+// OnReturn sets the function receiving the publishings of the session
+// returned by the server, replacing the one of the client, see
+// Client.OnReturn
+func (s *Session) OnReturn(fn func(amqp.Return)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onReturn = fn
+	if s.confirms != nil {
+		s.confirms.setOnReturn(fn)
+	}
+}
+
+// setOnReturn sets the function called with every return received
+func (t *confirmTracker) setOnReturn(fn func(amqp.Return)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onReturn = fn
+}
+
+// returned passes r to the function set with setOnReturn, if any
+func (t *confirmTracker) returned(r amqp.Return) {
+	t.mu.Lock()
+	fn := t.onReturn
+	t.mu.Unlock()
+
+	if fn != nil {
+		fn(r)
+	}
+}
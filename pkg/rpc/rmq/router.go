@@ -0,0 +1,70 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrNoRoute is returned by Router.Handle for deliveries no route matches
+// when the router has no fallback. Subscribe nacks such deliveries without
+// requeueing them, unless opts.RequeuePolicy says otherwise, and keeps
+// consuming.
+var ErrNoRoute = errors.New("no route for message")
+
+/*
+Router dispatches the deliveries of a subscription to different handlers,
+pass its Handle method to SubscribeHandler.
+
+Routes are keyed by routing key patterns as used to bind queues to a topic
+exchange, where "*" matches one word and "#" zero or more words, see
+MatchTopic. A route whose key equals the routing key wins, else the first
+matching pattern in lexical order. Deliveries matching no route go to
+Fallback, or fail with ErrNoRoute when Fallback is nil.
+
+Key returns what to match the routes against, e.g. a header. nil matches the
+routing key of the delivery.
+*/
+type Router struct {
+	Routes   map[string]Handler
+	Fallback Handler
+	Key      func(msg amqp.Delivery) string
+}
+
+// Handle calls the handler of the route matching msg
+func (r *Router) Handle(ctx context.Context, msg amqp.Delivery) (amqp.Publishing, error) {
+	key := msg.RoutingKey
+	if r.Key != nil {
+		key = r.Key(msg)
+	}
+
+	if handler := r.match(key); handler != nil {
+		return handler(ctx, msg)
+	}
+	if r.Fallback != nil {
+		return r.Fallback(ctx, msg)
+	}
+	return amqp.Publishing{}, fmt.Errorf("%w: [%s]", ErrNoRoute, key)
+}
+
+func (r *Router) match(key string) Handler {
+	if handler, ok := r.Routes[key]; ok {
+		return handler
+	}
+
+	patterns := make([]string, 0, len(r.Routes))
+	for pattern := range r.Routes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if MatchTopic(pattern, key) {
+			return r.Routes[pattern]
+		}
+	}
+	return nil
+}
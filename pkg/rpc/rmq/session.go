@@ -0,0 +1,272 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/streadway/amqp"
+)
+
+/*
+Session holds one connection and one channel so that several operations,
+e.g. declaring an exchange, declaring a queue and binding them, run on the
+same channel instead of opening a connection and a channel per call.
+
+A session is safe for concurrent use, its operations are serialized on the
+channel. A session must be closed once it is no longer needed. If the server
+closes the channel because of an error, all further operations on the session
+fail and a new session has to be opened.
+*/
+type Session struct {
+	conn    *amqp.Connection
+	ch      *amqp.Channel
+	pc      *pooledConn // nil unless the client is pooled
+	pch     *pooledChan // nil unless the client is pooled
+	closed  int32       // set once Close was called
+	tainted int32       // set once the channel must not be reused
+	client  *Client
+	logger  Logger
+	metrics MetricsHook
+
+	propagator Propagator
+	tracer     Tracer
+	onReturn   func(amqp.Return)
+	onLost     func([]Unconfirmed)
+
+	// mu serializes publishing so that delivery tags
+	// of publisher confirms match their publishings
+	mu       sync.Mutex
+	confirms *confirmTracker // nil unless in confirm mode
+	tx       bool            // set once in transaction mode
+}
+
+/*
+OpenSession opens a connection (or takes one from the pool of a pooled
+client) and a channel on it.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) OpenSession(connOpts *ConnectOpts) (*Session, error) {
+	return c.OpenSessionContext(context.Background(), connOpts)
+}
+
+// OpenSessionContext is like OpenSession but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) OpenSessionContext(ctx context.Context, connOpts *ConnectOpts) (*Session, error) {
+	if !c.ops.start() {
+		return nil, ErrClientClosed
+	}
+
+	actx, cancel := withTimeout(ctx, connOpts)
+	conn, pc, err := c.acquire(actx, connOpts)
+	cancel()
+	if err != nil {
+		c.ops.done()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+
+	s := &Session{
+		conn:   conn,
+		pc:     pc,
+		client: c,
+		logger: c.loggerFor(connOpts),
+	}
+
+	if pc != nil {
+		s.pch, err = c.pool.channel(pc)
+		if err != nil {
+			c.pool.put(pc, nil)
+			c.ops.done()
+			return nil, fmt.Errorf("open channel: %w", err)
+		}
+		s.ch = s.pch.ch
+	} else {
+		s.ch, err = conn.Channel()
+		if err != nil {
+			s.release()
+			c.ops.done()
+			return nil, fmt.Errorf("open channel: %w", err)
+		}
+	}
+
+	c.mu.RLock()
+	s.metrics = c.metrics
+	s.propagator = c.propagator
+	s.tracer = c.tracer
+	s.onReturn = c.onReturn
+	s.onLost = c.onLost
+	c.mu.RUnlock()
+
+	return s, nil
+}
+
+// run opens a session, calls fn with it and closes the session again.
+// A connOpts.OperationTimeout bounds all of it.
+func (c *Client) run(ctx context.Context, connOpts *ConnectOpts, fn func(s *Session) error) error {
+	ctx, cancel := withTimeout(ctx, connOpts)
+	defer cancel()
+
+	s, err := c.OpenSessionContext(ctx, connOpts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if connOpts == nil || connOpts.OperationTimeout <= 0 {
+		return fn(s)
+	}
+	return s.do(ctx, func() error {
+		return fn(s)
+	})
+}
+
+/*
+WithChannel opens a channel, calls fn with it and closes it again, for AMQP
+methods this package doesn't wrap, e.g. basic.get or basic.recover. The
+channel must not be used after fn returns. It is never reused by a pooled
+client, as fn may change its state.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+fn is the function using the channel, its error is returned
+*/
+func (c *Client) WithChannel(connOpts *ConnectOpts, fn func(ch *amqp.Channel) error) error {
+	return c.WithChannelContext(context.Background(), connOpts, fn)
+}
+
+// WithChannelContext is like WithChannel but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) WithChannelContext(ctx context.Context, connOpts *ConnectOpts, fn func(ch *amqp.Channel) error) error {
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.WithChannel(fn)
+	})
+}
+
+// WithChannel calls fn with the session channel, see Client.WithChannel.
+// Operations of the session must not run while fn runs.
+func (s *Session) WithChannel(fn func(ch *amqp.Channel) error) error {
+	s.taint()
+	return fn(s.ch)
+}
+
+// Close closes the session channel and releases its connection. A pooled
+// client keeps the channel open for reuse unless its state was changed.
+// It is safe to call Close multiple times, only the first call closes.
+func (s *Session) Close() error {
+	if !atomic.CompareAndSwapInt32(&s.closed, 0, 1) {
+		return nil
+	}
+	defer s.client.ops.done()
+	s.client.listeners.forget(s)
+
+	if s.pc == nil {
+		err := s.ch.Close()
+		s.release()
+		return err
+	}
+
+	if atomic.LoadInt32(&s.tainted) == 0 {
+		s.client.pool.put(s.pc, s.pch)
+		return nil
+	}
+
+	err := s.ch.Close()
+	s.client.pool.put(s.pc, nil)
+	return err
+}
+
+// release closes the connection of a session of a client which is
+// neither pooled nor created with NewClientFromConnection
+func (s *Session) release() {
+	if s.client.conn == nil {
+		s.conn.Close()
+	}
+}
+
+// taint keeps the channel from being reused by a pooled client once the
+// session is closed, e.g. because it holds consumers or prefetch limits
+// other operations expect to be unset
+func (s *Session) taint() {
+	atomic.StoreInt32(&s.tainted, 1)
+}
+
+// do runs fn and waits until it returns or ctx is done. In the latter case
+// fn is abandoned and the session is closed in the background, as an
+// operation stuck e.g. on TCP backpressure leaves the channel unusable.
+func (s *Session) do(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		s.taint()
+		go s.Close()
+		return ctx.Err()
+	}
+}
+
+/*
+NotifyClose returns a chan which receives the error when the connection of
+the session is closed by the server or because of a network failure, e.g.
+on broker shutdown or when the credentials were revoked. The chan is closed
+without a value on a graceful close, and when the session is closed first.
+
+For a session of a pooled client the connection is shared and may live on
+after the session is closed, the chan then stops listening on it.
+*/
+func (s *Session) NotifyClose() <-chan *amqp.Error {
+	ch := make(chan *amqp.Error, 1)
+	s.client.listeners.notifyClose(s, ch)
+	return ch
+}
+
+// NotifyChannelClose is like NotifyClose but for the session channel,
+// which is also closed by the server on any channel exception
+func (s *Session) NotifyChannelClose() <-chan *amqp.Error {
+	s.taint()
+	return s.ch.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+/*
+NotifyFlow returns a chan which receives false when the server asks to pause
+publishing on the session channel and true when publishing may resume. This
+only matters for publishers on busy brokers.
+
+The chan must be read continuously until it is closed, together with the
+channel, as the session blocks while the value is not received.
+
+Recent RabbitMQ versions throttle publishers by blocking the connection
+instead, see NotifyBlocked.
+*/
+func (s *Session) NotifyFlow() <-chan bool {
+	s.taint()
+	return s.ch.NotifyFlow(make(chan bool, 1))
+}
+
+/*
+NotifyBlocked returns a chan which receives an event with Active set when
+RabbitMQ blocks the connection of the session from publishing because it
+runs low on memory or disk space, and an event with Active unset once it
+unblocked it. See also Client.NotifyBlocked.
+
+Unlike the chan of NotifyFlow it never blocks the connection, which a
+pooled client shares with other sessions, events are dropped while it is
+full. It is closed when the session or its connection is closed.
+*/
+func (s *Session) NotifyBlocked() <-chan amqp.Blocking {
+	ch := make(chan amqp.Blocking, 4)
+	s.client.listeners.notifyBlocked(s, ch)
+	return ch
+}
@@ -0,0 +1,84 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClientClosed is returned by the operations of a client
+// once Shutdown has been called
+var ErrClientClosed = errors.New("client closed")
+
+// opTracker counts the open sessions of a client so that
+// Shutdown can wait until they are closed
+type opTracker struct {
+	mu      sync.Mutex
+	closing bool
+	n       int
+	idle    chan struct{} // closed once n drops to zero while closing
+}
+
+// start reports whether a session may be opened and counts it if so
+func (t *opTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closing {
+		return false
+	}
+	t.n++
+	return true
+}
+
+func (t *opTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n--
+	if t.n == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// shutdown stops new sessions and returns a chan
+// closed once there are no open sessions left
+func (t *opTracker) shutdown() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closing = true
+	idle := make(chan struct{})
+	if t.n == 0 {
+		close(idle)
+		return idle
+	}
+	if t.idle == nil {
+		t.idle = idle
+	}
+	return t.idle
+}
+
+/*
+Shutdown stops the client gracefully, e.g. on SIGTERM. New operations fail
+with ErrClientClosed right away, subscriptions are cancelled and finish the
+messages already delivered as when their context is done, and operations in
+flight, including waiting for publisher confirms and open sessions, are
+waited for. Then the connections of a pooled client are closed.
+
+ctx bounds the wait. Once ctx is done Shutdown closes the connections of a
+pooled client without waiting any longer and returns ctx.Err().
+*/
+func (c *Client) Shutdown(ctx context.Context) error {
+	idle := c.ops.shutdown()
+	c.consumers.cancelAll()
+
+	select {
+	case <-idle:
+		return c.Close()
+	case <-ctx.Done():
+		c.Close()
+		return ctx.Err()
+	}
+}
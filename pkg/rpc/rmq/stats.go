@@ -0,0 +1,84 @@
+package rmq
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+PoolStats is a snapshot of the state of a client, e.g. for a debug endpoint.
+Use SetMetricsHook to export metrics instead.
+
+OpenConns, IdleConns and OpenChannels are only counted for pooled clients.
+IdleConns are the open connections no operation is using, OpenChannels the
+channels of running operations plus the idle channels kept for reuse.
+
+Publishes counts the messages written to a channel, whether or not they were
+confirmed. Reconnects counts the retries to connect and the resubscribes of
+SubscribeForever, as reported to MetricsHook.OnReconnect.
+
+LastError is the error of the last failed connection attempt, nil if every
+attempt succeeded.
+*/
+type PoolStats struct {
+	OpenConns    int
+	IdleConns    int
+	OpenChannels int
+	Publishes    uint64
+	Reconnects   uint64
+	LastError    error
+}
+
+// clientStats holds the counters of a client. The uint64 fields come first
+// so that they are 64-bit aligned for atomic access on 32-bit platforms.
+type clientStats struct {
+	publishes  uint64
+	reconnects uint64
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (st *clientStats) setErr(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.lastErr = err
+}
+
+// Stats returns a snapshot of the connections and counters of the client
+func (c *Client) Stats() PoolStats {
+	c.stats.mu.Lock()
+	lastErr := c.stats.lastErr
+	c.stats.mu.Unlock()
+
+	stats := PoolStats{
+		Publishes:  atomic.LoadUint64(&c.stats.publishes),
+		Reconnects: atomic.LoadUint64(&c.stats.reconnects),
+		LastError:  lastErr,
+	}
+	if c.pool != nil {
+		c.pool.stats(&stats)
+	}
+	if c.conn != nil && !c.conn.IsClosed() {
+		stats.OpenConns = 1
+	}
+	return stats
+}
+
+// stats fills in the connection and channel counts of the pool
+func (p *connPool) stats(stats *PoolStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pc := range p.conns {
+		if pc.conn.IsClosed() {
+			continue
+		}
+		stats.OpenConns++
+		if pc.refs == 0 {
+			stats.IdleConns++
+		}
+		stats.OpenChannels += pc.refs + len(pc.idle)
+	}
+}
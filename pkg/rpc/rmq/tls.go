@@ -0,0 +1,35 @@
+package rmq
+
+import (
+	"crypto/tls"
+)
+
+/*
+SecureTLSConfig returns a TLS configuration for ConnectOpts.TLSConfig which
+requires TLS 1.2 or later and only offers cipher suites with forward secrecy
+and authenticated encryption, i.e. ECDHE key exchange with AES-GCM or
+ChaCha20-Poly1305. The cipher suites of TLS 1.3 are not configurable and all
+of them are secure.
+
+A new config is returned on every call, set RootCAs or Certificates on it as
+needed. RabbitMQ must allow one of these suites, which recent versions do by
+default.
+*/
+func SecureTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		CurvePreferences: []tls.CurveID{
+			tls.X25519,
+			tls.CurveP256,
+			tls.CurveP384,
+		},
+	}
+}
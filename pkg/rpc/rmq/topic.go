@@ -0,0 +1,96 @@
+package rmq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Wildcards of topic binding patterns, see TopicPattern
+const (
+	TopicAnyWord  = "*" // matches exactly one word
+	TopicAnyWords = "#" // matches zero or more words
+)
+
+/*
+TopicPattern joins words into a binding pattern for a topic exchange, e.g.
+TopicPattern("orders", TopicAnyWord, "created") returns "orders.*.created".
+It fails with ErrInvalidBinding if a word is empty, holds a dot or has a
+wildcard within it, so a pattern built from variables can't silently match
+nothing.
+*/
+func TopicPattern(words ...string) (string, error) {
+	for i, word := range words {
+		if strings.Contains(word, ".") {
+			return "", fmt.Errorf("%w: word #%d [%s] holds a dot", ErrInvalidBinding, i+1, word)
+		}
+	}
+
+	pattern := strings.Join(words, ".")
+	if err := ValidateTopicPattern(pattern); err != nil {
+		return "", err
+	}
+	return pattern, nil
+}
+
+/*
+ValidateTopicPattern returns ErrInvalidBinding with a description of the
+mistake if pattern is not a well formed binding pattern for a topic
+exchange: dot separated words which are not empty, where "*" and "#" are
+whole words. The server accepts such patterns, but e.g. "orders..created"
+or "orders.created*" only match routing keys nobody publishes with. An
+empty pattern is valid and matches the empty routing key.
+*/
+func ValidateTopicPattern(pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+
+	for i, word := range strings.Split(pattern, ".") {
+		switch {
+		case word == "":
+			return fmt.Errorf("%w: word #%d of [%s] is empty", ErrInvalidBinding, i+1, pattern)
+		case word != TopicAnyWord && word != TopicAnyWords && strings.ContainsAny(word, "*#"):
+			return fmt.Errorf("%w: wildcards match whole words only, [%s] of [%s] matches literally",
+				ErrInvalidBinding, word, pattern)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether the routing key matches the binding pattern
+// the way a topic exchange does. Both are lists of words separated by dots,
+// in the pattern "*" matches exactly one word and "#" zero or more words.
+func MatchTopic(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// collapse repeated #, then try every possible tail
+			for len(pattern) > 1 && pattern[1] == "#" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchWords(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || pattern[0] != key[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
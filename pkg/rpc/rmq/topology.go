@@ -0,0 +1,376 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/streadway/amqp"
+)
+
+// ExchangeDef describes an exchange of a Topology
+type ExchangeDef struct {
+	Name string
+	Opts *DeclareExchangeOpts // nil means DefaultDeclareExchangeOpts
+}
+
+// QueueDef describes a queue of a Topology
+type QueueDef struct {
+	Name string
+	Opts *DeclareQueueOpts // nil means DefaultDeclareQueueOpts
+}
+
+// QueueBindingDef describes the binding of a queue to an exchange
+type QueueBindingDef struct {
+	Exchange string
+	Queue    string
+	Key      string
+	Opts     *QueueBindOpts // nil means DefaultQueueBindOpts
+}
+
+// ExchangeBindingDef describes the binding of an exchange to another one
+type ExchangeBindingDef struct {
+	Destination string
+	Key         string
+	Source      string
+	Opts        *ExchangeBindOpts // nil means DefaultExchangeBindOpts
+}
+
+// Topology describes exchanges, queues and their bindings, see
+// DeclareTopology. With DryRun set DeclareTopology only logs the
+// operations it would run, see Plan.
+type Topology struct {
+	Exchanges        []ExchangeDef
+	Queues           []QueueDef
+	QueueBindings    []QueueBindingDef
+	ExchangeBindings []ExchangeBindingDef
+
+	DryRun bool // default false
+}
+
+/*
+Plan returns the operations DeclareTopology runs for the topology, in order,
+e.g. "declare exchange [orders] (topic, durable)", to review changes before
+they touch a broker. The options of every definition are checked like when
+declaring, the first invalid one is returned as error. Whether the broker
+accepts the topology, e.g. because an exchange exists with other options, is
+only known once declared.
+*/
+func (t *Topology) Plan() ([]string, error) {
+	var plan []string
+
+	for _, e := range t.Exchanges {
+		opts := DefaultDeclareExchangeOpts()
+		if e.Opts != nil {
+			opts = e.Opts
+		}
+		if err := opts.validate(); err != nil {
+			return plan, fmt.Errorf("declare exchange [%s]: %w", e.Name, err)
+		}
+		plan = append(plan, planOp(fmt.Sprintf("declare exchange [%s]", e.Name),
+			opts.kind(),
+			planFlag("durable", opts.Durable),
+			planFlag("auto-delete", opts.AutoDeleted),
+			planFlag("internal", opts.Internal),
+			planArgs(opts.args())))
+	}
+
+	for _, q := range t.Queues {
+		opts := DefaultDeclareQueueOpts()
+		if q.Opts != nil {
+			opts = q.Opts
+		}
+		if err := opts.validate(); err != nil {
+			return plan, fmt.Errorf("declare queue [%s]: %w", q.Name, err)
+		}
+		plan = append(plan, planOp(fmt.Sprintf("declare queue [%s]", q.Name),
+			planFlag("durable", opts.Durable),
+			planFlag("auto-delete", opts.AutoDelete),
+			planFlag("exclusive", opts.Exclusive),
+			planArgs(opts.args())))
+	}
+
+	for _, b := range t.QueueBindings {
+		opts := DefaultQueueBindOpts()
+		if b.Opts != nil {
+			opts = b.Opts
+		}
+		args, err := opts.args()
+		if err == nil {
+			err = checkKey(b.Key)
+		}
+		if err == nil && opts.Strict {
+			err = opts.checkKind(b.Key)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("bind queue [%s] to exchange [%s] with key [%s]: %w",
+				b.Queue, b.Exchange, b.Key, err)
+		}
+		plan = append(plan, planOp(fmt.Sprintf("bind queue [%s] to exchange [%s] with key [%s]",
+			b.Queue, b.Exchange, b.Key), planArgs(args)))
+	}
+
+	for _, b := range t.ExchangeBindings {
+		opts := DefaultExchangeBindOpts()
+		if b.Opts != nil {
+			opts = b.Opts
+		}
+		err := checkKey(b.Key)
+		if err == nil {
+			err = checkTable("args", opts.Args)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("bind exchange [%s] to exchange [%s] with key [%s]: %w",
+				b.Destination, b.Source, b.Key, err)
+		}
+		plan = append(plan, planOp(fmt.Sprintf("bind exchange [%s] to exchange [%s] with key [%s]",
+			b.Destination, b.Source, b.Key), planArgs(opts.Args)))
+	}
+
+	return plan, nil
+}
+
+// planOp returns op followed by the non empty details in parentheses
+func planOp(op string, details ...string) string {
+	var set []string
+	for _, d := range details {
+		if d != "" {
+			set = append(set, d)
+		}
+	}
+	if len(set) == 0 {
+		return op
+	}
+	return op + " (" + strings.Join(set, ", ") + ")"
+}
+
+// planFlag returns name if set is true, else ""
+func planFlag(name string, set bool) string {
+	if !set {
+		return ""
+	}
+	return name
+}
+
+// planArgs returns args formatted for a plan, "" if empty
+func planArgs(args amqp.Table) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("args %v", map[string]interface{}(args))
+}
+
+// dryRun logs the plan of topo through logf and returns its error
+func dryRun(topo *Topology, logf func(format string, v ...interface{})) error {
+	plan, err := topo.Plan()
+	for _, op := range plan {
+		logf("Dry run: %s\n", op)
+	}
+	return err
+}
+
+/*
+DeclareTopology declares everything described by topo on a single channel,
+exchanges first, then queues, then the bindings, so that the definitions may
+be given in any order.
+
+Declaring an exchange or a queue which already exists with the same options
+and binding twice are no-ops on the server, so an existing topology can be
+declared again on every start. Declaring fails if an exchange or queue
+already exists with other options, nothing after the failing definition is
+declared then.
+
+ctx is the context object that can be used to stop retrying to connect and
+to stop declaring the remaining definitions
+
+topo is the topology to declare. With topo.DryRun nothing is declared and
+the client doesn't even connect, the planned operations are logged instead
+and the first invalid definition fails.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) DeclareTopology(ctx context.Context, topo *Topology, connOpts *ConnectOpts) error {
+	if topo.DryRun {
+		return dryRun(topo, c.logf)
+	}
+
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.DeclareTopology(ctx, topo)
+	})
+}
+
+// DeclareTopology declares topo using the session channel,
+// see Client.DeclareTopology
+func (s *Session) DeclareTopology(ctx context.Context, topo *Topology) error {
+	if topo.DryRun {
+		return dryRun(topo, s.logger.Printf)
+	}
+
+	for _, e := range topo.Exchanges {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.ExchangeDeclare(e.Name, e.Opts); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range topo.Queues {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := s.QueueDeclare(q.Name, q.Opts); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range topo.QueueBindings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.QueueBind(b.Exchange, b.Queue, b.Key, b.Opts); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range topo.ExchangeBindings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.ExchangeBind(b.Destination, b.Key, b.Source, b.Opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SubscribeTopology describes the exchange, queue and bindings a consumer
+// needs, see SubscribeWithTopology
+type SubscribeTopology struct {
+	Exchange     string
+	ExchangeOpts *DeclareExchangeOpts // nil means DefaultDeclareExchangeOpts
+	Queue        string
+	QueueOpts    *DeclareQueueOpts // nil means DefaultDeclareQueueOpts
+	BindingKeys  []string          // Routing keys binding Queue to Exchange
+	QosOpts      *ChannelOpts      // nil means DefaultChannelOpts
+}
+
+// topology returns the Topology declaring the exchange, if any,
+// the queue and its bindings
+func (t *SubscribeTopology) topology() *Topology {
+	topo := &Topology{
+		Queues: []QueueDef{{Name: t.Queue, Opts: t.QueueOpts}},
+	}
+	if t.Exchange == "" {
+		// the default exchange exists and can't be bound to
+		return topo
+	}
+
+	topo.Exchanges = []ExchangeDef{{Name: t.Exchange, Opts: t.ExchangeOpts}}
+	for _, key := range t.BindingKeys {
+		topo.QueueBindings = append(topo.QueueBindings, QueueBindingDef{
+			Exchange: t.Exchange,
+			Queue:    t.Queue,
+			Key:      key,
+		})
+	}
+	return topo
+}
+
+/*
+SubscribeWithTopology declares the exchange and the queue of topo, binds
+the queue with each of the binding keys, sets the prefetch limits and then
+consumes from the queue like Subscribe, all on a single channel. When
+topo.Exchange is empty only the queue is declared, the default exchange
+routes to it by name. With opts.Reconnect the topology is declared again
+after every reconnect, see SubscribeOpts.Topology, which topo replaces.
+
+See Subscribe for the other parameters.
+*/
+func (c *Client) SubscribeWithTopology(
+	ctx context.Context,
+	topo SubscribeTopology,
+	opts *SubscribeOpts,
+	connOpts *ConnectOpts,
+	handler func(amqp.Delivery) (amqp.Publishing, error),
+) error {
+
+	defaultOpts := *DefaultSubscribeOpts()
+	if opts != nil {
+		defaultOpts = *opts
+	}
+	defaultOpts.Topology = topo.topology()
+
+	return c.Subscribe(ctx, topo.Queue, &defaultOpts, topo.QosOpts, connOpts, handler)
+}
+
+// ShardedQueuesDef describes a numbered set of queues named
+// Prefix.0 to Prefix.<Count-1> all bound to Exchange with Key
+type ShardedQueuesDef struct {
+	Prefix   string
+	Count    int
+	Exchange string
+	Key      string
+	Opts     *DeclareQueueOpts // nil means DefaultDeclareQueueOpts
+}
+
+// names returns the names of the queues
+func (d *ShardedQueuesDef) names() []string {
+	names := make([]string, d.Count)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s.%d", d.Prefix, i)
+	}
+	return names
+}
+
+// topology returns the Topology declaring the queues and their bindings
+func (d *ShardedQueuesDef) topology() *Topology {
+	topo := &Topology{}
+	for _, name := range d.names() {
+		topo.Queues = append(topo.Queues, QueueDef{Name: name, Opts: d.Opts})
+		topo.QueueBindings = append(topo.QueueBindings, QueueBindingDef{
+			Exchange: d.Exchange,
+			Queue:    name,
+			Key:      d.Key,
+		})
+	}
+	return topo
+}
+
+/*
+DeclareShardedQueues declares the queues of def and binds each of them to
+the exchange on a single channel and returns their names. The exchange must
+exist. Like DeclareTopology it can be run again, e.g. on every deploy, as
+long as the options stay the same.
+
+ctx is the context object that can be used to stop retrying to connect and
+to stop declaring the remaining queues
+
+def describes the queues
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+*/
+func (c *Client) DeclareShardedQueues(ctx context.Context, def *ShardedQueuesDef, connOpts *ConnectOpts) ([]string, error) {
+	var names []string
+	err := c.run(ctx, connOpts, func(s *Session) (err error) {
+		names, err = s.DeclareShardedQueues(ctx, def)
+		return err
+	})
+	return names, err
+}
+
+// DeclareShardedQueues declares the queues of def using the session
+// channel, see Client.DeclareShardedQueues
+func (s *Session) DeclareShardedQueues(ctx context.Context, def *ShardedQueuesDef) ([]string, error) {
+	if def.Count < 1 {
+		return nil, fmt.Errorf("invalid count of sharded queues [%d], must be at least 1", def.Count)
+	}
+
+	if err := s.DeclareTopology(ctx, def.topology()); err != nil {
+		return nil, err
+	}
+	return def.names(), nil
+}
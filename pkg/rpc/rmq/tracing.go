@@ -0,0 +1,68 @@
+package rmq
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+)
+
+/*
+Propagator carries a trace context across RabbitMQ in the headers of the
+messages, e.g. as W3C traceparent and tracestate headers. It can be
+implemented with the propagators of OpenTelemetry.
+*/
+type Propagator interface {
+	// Inject writes the trace context of ctx into headers
+	Inject(ctx context.Context, headers amqp.Table)
+
+	// Extract returns a copy of ctx carrying the
+	// trace context read from headers, if any
+	Extract(ctx context.Context, headers amqp.Table) context.Context
+}
+
+// Tracer starts the span around the handling of a delivery
+type Tracer interface {
+	// Start starts a span named name as child of the span in ctx and
+	// returns the context holding it along with the function ending it
+	Start(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+// SetTracing makes the client inject the trace context into published
+// messages with p and extract it from deliveries before calling the
+// handler. When t is not nil the handler runs in a span started with t.
+// Either may be nil. Sessions already open keep the previous ones.
+func (c *Client) SetTracing(p Propagator, t Tracer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.propagator = p
+	c.tracer = t
+}
+
+// inject returns msg with the trace context of ctx in its headers,
+// the headers of the caller are not modified
+func (s *Session) inject(ctx context.Context, msg amqp.Publishing) amqp.Publishing {
+	if s.propagator == nil {
+		return msg
+	}
+
+	headers := make(amqp.Table, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	s.propagator.Inject(ctx, headers)
+	msg.Headers = headers
+	return msg
+}
+
+// startSpan starts the span for handling a delivery from queue,
+// the returned function must be called with the handler error
+func (s *Session) startSpan(ctx context.Context, queue string, msg amqp.Delivery) (context.Context, func(error)) {
+	if s.propagator != nil {
+		ctx = s.propagator.Extract(ctx, msg.Headers)
+	}
+	if s.tracer == nil {
+		return ctx, func(error) {}
+	}
+	return s.tracer.Start(ctx, queue+" process")
+}
@@ -0,0 +1,76 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+)
+
+// ErrConfirmMode is returned by Session.Tx when the session channel is in
+// confirm mode, and by publishing with confirms on a session in transaction
+// mode, as a channel can't be in both
+var ErrConfirmMode = errors.New("channel can't be in both confirm and transaction mode")
+
+/*
+Tx runs fn in an AMQP transaction. It puts a channel into transaction mode,
+calls fn with it and commits what fn published and acked if fn returns nil,
+or rolls it back if fn fails. Messages published in a rolled back
+transaction are never delivered.
+
+A channel is either in transaction mode or in confirm mode, so the channel
+passed to fn must not be put into confirm mode. Publishing with
+PublishOpts.Confirm or Mandatory on a session fails with ErrConfirmMode once
+Session.Tx was called on it, the channel stays usable. Publisher confirms
+are much faster, prefer them unless the atomicity of a transaction is
+needed.
+
+connOpts provides connection options such as retry to connect if connection
+closes or fails and number of retries to attempt.
+
+fn is the function publishing or acking within the transaction
+*/
+func (c *Client) Tx(connOpts *ConnectOpts, fn func(txCh *amqp.Channel) error) error {
+	return c.TxContext(context.Background(), connOpts, fn)
+}
+
+// TxContext is like Tx but stops retrying to
+// connect as soon as ctx is done
+func (c *Client) TxContext(ctx context.Context, connOpts *ConnectOpts, fn func(txCh *amqp.Channel) error) error {
+	return c.run(ctx, connOpts, func(s *Session) error {
+		return s.Tx(fn)
+	})
+}
+
+// Tx runs fn in a transaction on the session channel, see Client.Tx.
+// The channel stays in transaction mode, so every call commits or rolls
+// back on its own. fn must use txCh, not publish with the session.
+func (s *Session) Tx(fn func(txCh *amqp.Channel) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.confirms != nil {
+		return ErrConfirmMode
+	}
+
+	if !s.tx {
+		s.taint()
+		if err := s.ch.Tx(); err != nil {
+			return fmt.Errorf("start transaction: %w", err)
+		}
+		s.tx = true
+	}
+
+	if err := fn(s.ch); err != nil {
+		if rerr := s.ch.TxRollback(); rerr != nil {
+			return fmt.Errorf("%w (rollback failed: %s)", err, rerr.Error())
+		}
+		return err
+	}
+
+	if err := s.ch.TxCommit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
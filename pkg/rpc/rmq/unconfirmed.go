@@ -0,0 +1,86 @@
+package rmq
+
+import (
+	"sort"
+
+	"github.com/streadway/amqp"
+)
+
+// Unconfirmed is a publishing sent in confirm mode which was
+// neither acked nor nacked before its channel closed
+type Unconfirmed struct {
+	DeliveryTag uint64
+	Exchange    string
+	Key         string
+	Msg         amqp.Publishing // as published, with the PublishOpts applied
+}
+
+/*
+OnConfirmLost sets the function receiving the publishings of a session in
+confirm mode which were still waiting for their confirmation when the channel
+closed, e.g. because the connection dropped. nil (the default) disables it.
+Sessions already open keep the previous function.
+
+The server may or may not have received these publishings. Publish them again
+on a new session to get them delivered at least once, or drop them if
+duplicates must be avoided. Publish calls waiting for their confirmation
+still fail with ErrConfirmLost, as does Confirmation.Wait.
+
+fn is called once per session, with the publishings in the order they were
+sent, from the goroutine receiving the confirmations of the channel. The
+publishings are kept in memory until confirmed while fn is set.
+*/
+func (c *Client) OnConfirmLost(fn func([]Unconfirmed)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onLost = fn
+}
+
+// OnConfirmLost sets the function receiving the unconfirmed publishings of
+// the session, replacing the one of the client, see Client.OnConfirmLost.
+// Publishings sent before it was set are not passed to fn.
+func (s *Session) OnConfirmLost(fn func([]Unconfirmed)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onLost = fn
+	if s.confirms != nil {
+		s.confirms.setOnLost(fn)
+	}
+}
+
+// setOnLost sets the function called with the unconfirmed
+// publishings once the channel closed
+func (t *confirmTracker) setOnLost(fn func([]Unconfirmed)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onLost = fn
+	if fn == nil {
+		t.pending = make(map[uint64]Unconfirmed)
+	}
+}
+
+// drop stops tracking a publishing which could not be sent
+func (t *confirmTracker) drop(tag uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.waiting, tag)
+	delete(t.pending, tag)
+}
+
+// unconfirmed returns the pending publishings ordered by
+// delivery tag. Must be called with mu held.
+func (t *confirmTracker) unconfirmed() []Unconfirmed {
+	lost := make([]Unconfirmed, 0, len(t.pending))
+	for tag, p := range t.pending {
+		lost = append(lost, p)
+		delete(t.pending, tag)
+	}
+	sort.Slice(lost, func(i, j int) bool {
+		return lost[i].DeliveryTag < lost[j].DeliveryTag
+	})
+	return lost
+}
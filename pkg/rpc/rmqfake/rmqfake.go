@@ -0,0 +1,518 @@
+/*
+Package rmqfake provides an in-memory implementation of rpc.RabbitMQRPC for
+unit tests of code depending on the interface, so that they run without a
+RabbitMQ server.
+
+Published messages are recorded and routed to the bound queues like the
+server does for direct, fanout and topic exchanges and the default exchange.
+Subscribe consumes from those queues. Headers exchanges are accepted but
+never route. Connection options are ignored.
+*/
+package rmqfake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/raghuP9/amqp/pkg/rpc"
+	"github.com/raghuP9/amqp/pkg/rpc/rmq"
+	"github.com/streadway/amqp"
+)
+
+// Published is a message recorded by Fake.Publish
+type Published struct {
+	Exchange string
+	Key      string
+	Msg      amqp.Publishing
+}
+
+type binding struct {
+	exchange string
+	queue    string
+	key      string
+}
+
+type queue struct {
+	msgs      []amqp.Delivery
+	consumers int
+	exclusive bool          // set while an exclusive consumer consumes
+	ready     chan struct{} // closed and replaced when messages arrive
+}
+
+// Fake is an in-memory RabbitMQ, the zero value is ready to use
+type Fake struct {
+	mu        sync.Mutex
+	exchanges map[string]string // name to kind
+	queues    map[string]*queue
+	bindings  []binding
+	published []Published
+	seq       int
+}
+
+var _ rpc.RabbitMQRPC = (*Fake)(nil)
+
+// New returns an empty Fake
+func New() *Fake {
+	return &Fake{}
+}
+
+// notFound returns the error the server closes the channel with
+func notFound(format string, v ...interface{}) error {
+	return &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - " + fmt.Sprintf(format, v...)}
+}
+
+func accessRefused(format string, v ...interface{}) error {
+	return &amqp.Error{Code: amqp.AccessRefused, Reason: "ACCESS_REFUSED - " + fmt.Sprintf(format, v...)}
+}
+
+func preconditionFailed(format string, v ...interface{}) error {
+	return &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - " + fmt.Sprintf(format, v...)}
+}
+
+// init lazily creates the maps. Must be called with mu held.
+func (f *Fake) init() {
+	if f.exchanges == nil {
+		f.exchanges = make(map[string]string)
+		f.queues = make(map[string]*queue)
+	}
+}
+
+// ExchangeDeclare declares an exchange, redeclaring it with another kind fails
+func (f *Fake) ExchangeDeclare(name string, opts *rmq.DeclareExchangeOpts, connOpts *rmq.ConnectOpts) error {
+	if opts == nil {
+		opts = rmq.DefaultDeclareExchangeOpts()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	if kind, ok := f.exchanges[name]; ok && kind != opts.Kind {
+		return preconditionFailed("exchange '%s' exists with type '%s'", name, kind)
+	}
+	f.exchanges[name] = opts.Kind
+	return nil
+}
+
+// ExchangeDelete deletes an exchange along with its bindings
+func (f *Fake) ExchangeDelete(name string, ifUnused, noWait bool, connOpts *rmq.ConnectOpts) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	if _, ok := f.exchanges[name]; !ok {
+		return notFound("no exchange '%s'", name)
+	}
+
+	bindings := make([]binding, 0, len(f.bindings))
+	for _, b := range f.bindings {
+		if b.exchange != name {
+			bindings = append(bindings, b)
+		}
+	}
+	if ifUnused && len(bindings) < len(f.bindings) {
+		return preconditionFailed("exchange '%s' in use", name)
+	}
+	f.bindings = bindings
+	delete(f.exchanges, name)
+	return nil
+}
+
+// QueueDeclare declares a queue, an empty name generates one
+func (f *Fake) QueueDeclare(name string, opts *rmq.DeclareQueueOpts, connOpts *rmq.ConnectOpts) (amqp.Queue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	if name == "" {
+		f.seq++
+		name = fmt.Sprintf("amq.gen-%d", f.seq)
+	}
+
+	q, ok := f.queues[name]
+	if !ok {
+		q = &queue{ready: make(chan struct{})}
+		f.queues[name] = q
+	}
+	return amqp.Queue{Name: name, Messages: len(q.msgs), Consumers: q.consumers}, nil
+}
+
+// QueueBind binds a queue to an exchange
+func (f *Fake) QueueBind(exchange, queue, key string, opts *rmq.QueueBindOpts, connOpts *rmq.ConnectOpts) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	if _, ok := f.exchanges[exchange]; !ok {
+		return notFound("no exchange '%s'", exchange)
+	}
+	if _, ok := f.queues[queue]; !ok {
+		return notFound("no queue '%s'", queue)
+	}
+
+	b := binding{exchange: exchange, queue: queue, key: key}
+	for _, existing := range f.bindings {
+		if existing == b {
+			return nil
+		}
+	}
+	f.bindings = append(f.bindings, b)
+	return nil
+}
+
+// QueueUnbind removes the binding of a queue to an exchange,
+// unbinding a binding which doesn't exist succeeds
+func (f *Fake) QueueUnbind(exchange, queue, key string, args amqp.Table, connOpts *rmq.ConnectOpts) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	if _, ok := f.exchanges[exchange]; !ok {
+		return notFound("no exchange '%s'", exchange)
+	}
+	if _, ok := f.queues[queue]; !ok {
+		return notFound("no queue '%s'", queue)
+	}
+
+	b := binding{exchange: exchange, queue: queue, key: key}
+	for i, existing := range f.bindings {
+		if existing == b {
+			f.bindings = append(f.bindings[:i], f.bindings[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// QueuePurge drops the messages of a queue and returns their number
+func (f *Fake) QueuePurge(name string, noWait bool, connOpts *rmq.ConnectOpts) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	q, ok := f.queues[name]
+	if !ok {
+		return 0, notFound("no queue '%s'", name)
+	}
+
+	n := len(q.msgs)
+	q.msgs = nil
+	return n, nil
+}
+
+// QueueDelete deletes a queue along with its bindings and
+// returns the number of messages it held
+func (f *Fake) QueueDelete(name string, opts *rmq.QueueDeleteOpts, connOpts *rmq.ConnectOpts) (int, error) {
+	if opts == nil {
+		opts = rmq.DefaultQueueDeleteOpts()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	q, ok := f.queues[name]
+	if !ok {
+		return 0, notFound("no queue '%s'", name)
+	}
+	if opts.IfUnused && q.consumers > 0 {
+		return 0, preconditionFailed("queue '%s' in use", name)
+	}
+	if opts.IfEmpty && len(q.msgs) > 0 {
+		return 0, preconditionFailed("queue '%s' not empty", name)
+	}
+
+	bindings := make([]binding, 0, len(f.bindings))
+	for _, b := range f.bindings {
+		if b.queue != name {
+			bindings = append(bindings, b)
+		}
+	}
+	f.bindings = bindings
+	delete(f.queues, name)
+	return len(q.msgs), nil
+}
+
+// Publish records msg and routes it to the matching queues. A mandatory
+// message matching no queue fails with a *rmq.ReturnError.
+func (f *Fake) Publish(msg amqp.Publishing, exchange, key string, opts *rmq.PublishOpts, connOpts *rmq.ConnectOpts) error {
+	if opts == nil {
+		opts = rmq.DefaultPublishOpts()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.init()
+
+	queues, err := f.route(exchange, key)
+	if err != nil {
+		return err
+	}
+
+	f.published = append(f.published, Published{Exchange: exchange, Key: key, Msg: msg})
+
+	if len(queues) == 0 && opts.Mandatory {
+		return &rmq.ReturnError{
+			ReplyCode:  amqp.NoRoute,
+			ReplyText:  "NO_ROUTE",
+			Exchange:   exchange,
+			RoutingKey: key,
+		}
+	}
+
+	for _, name := range queues {
+		f.queues[name].push(delivery(msg, exchange, key))
+	}
+	return nil
+}
+
+// route returns the names of the queues a message published to exchange
+// with key is routed to. Must be called with mu held.
+func (f *Fake) route(exchange, key string) ([]string, error) {
+	if exchange == "" {
+		if _, ok := f.queues[key]; ok {
+			return []string{key}, nil
+		}
+		return nil, nil
+	}
+
+	kind, ok := f.exchanges[exchange]
+	if !ok {
+		return nil, notFound("no exchange '%s'", exchange)
+	}
+
+	var queues []string
+	seen := make(map[string]bool)
+	for _, b := range f.bindings {
+		if b.exchange != exchange || seen[b.queue] {
+			continue
+		}
+
+		var match bool
+		switch kind {
+		case amqp.ExchangeDirect:
+			match = b.key == key
+		case amqp.ExchangeFanout:
+			match = true
+		case amqp.ExchangeTopic:
+			match = rmq.MatchTopic(b.key, key)
+		}
+		if match {
+			seen[b.queue] = true
+			queues = append(queues, b.queue)
+		}
+	}
+	return queues, nil
+}
+
+func delivery(msg amqp.Publishing, exchange, key string) amqp.Delivery {
+	return amqp.Delivery{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Exchange:        exchange,
+		RoutingKey:      key,
+		Body:            msg.Body,
+	}
+}
+
+// push appends msg and wakes up the consumers. Must be called with mu held.
+func (q *queue) push(msg amqp.Delivery) {
+	q.msgs = append(q.msgs, msg)
+	q.wake()
+}
+
+// requeue puts msg back at the head of the queue. Must be called with mu held.
+func (q *queue) requeue(msg amqp.Delivery) {
+	msg.Redelivered = true
+	q.msgs = append([]amqp.Delivery{msg}, q.msgs...)
+	q.wake()
+}
+
+func (q *queue) wake() {
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// Published returns the messages published so far, in order
+func (f *Fake) Published() []Published {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Published(nil), f.published...)
+}
+
+// Messages returns the messages waiting in a queue, in order
+func (f *Fake) Messages(name string) []amqp.Delivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q, ok := f.queues[name]
+	if !ok {
+		return nil
+	}
+	return append([]amqp.Delivery(nil), q.msgs...)
+}
+
+// Reset drops everything that was declared and published
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.exchanges = nil
+	f.queues = nil
+	f.bindings = nil
+	f.published = nil
+}
+
+/*
+Subscribe hands the messages of a queue to handler one at a time like
+rmq.Client.Subscribe, honouring CorrelationID, ListenIndefinitely,
+PublishResponse, ContinueOnError, RequeuePolicy, ExclusiveConsumer and the
+exchanges, queues and queue bindings of Topology. With ListenIndefinitely it
+returns nil once ctx is done, otherwise after handling one message.
+*/
+func (f *Fake) Subscribe(
+	ctx context.Context,
+	queue string,
+	opts *rmq.SubscribeOpts,
+	chanOpts *rmq.ChannelOpts,
+	connOpts *rmq.ConnectOpts,
+	handler func(amqp.Delivery) (amqp.Publishing, error),
+) error {
+
+	if opts == nil {
+		opts = rmq.DefaultSubscribeOpts()
+	}
+
+	if opts.Topology != nil {
+		if err := f.declare(opts.Topology); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	f.init()
+	q, ok := f.queues[queue]
+	if !ok {
+		f.mu.Unlock()
+		return notFound("no queue '%s'", queue)
+	}
+	if q.exclusive || (opts.ExclusiveConsumer && q.consumers > 0) {
+		f.mu.Unlock()
+		return accessRefused("queue '%s' in exclusive use", queue)
+	}
+	q.consumers++
+	q.exclusive = opts.ExclusiveConsumer
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		q.consumers--
+		q.exclusive = false
+		f.mu.Unlock()
+	}()
+
+	for {
+		msg, ok := f.next(ctx, q, opts.CorrelationID)
+		if !ok {
+			return nil
+		}
+
+		resp, err := handler(msg)
+		if err != nil {
+			requeue := opts.RequeuePolicy == nil || opts.RequeuePolicy(msg, err)
+			if requeue && !opts.AutoAck {
+				f.mu.Lock()
+				q.requeue(msg)
+				f.mu.Unlock()
+			}
+			if !opts.ContinueOnError {
+				return err
+			}
+			continue
+		}
+
+		if opts.PublishResponse && msg.ReplyTo != "" {
+			if resp.CorrelationId == "" {
+				resp.CorrelationId = msg.CorrelationId
+			}
+			if err := f.Publish(resp, "", msg.ReplyTo, nil, nil); err != nil {
+				return err
+			}
+		}
+
+		if !opts.ListenIndefinitely {
+			return nil
+		}
+	}
+}
+
+// declare declares the exchanges, queues and queue bindings of topo,
+// exchange bindings are not routed by the fake and thus ignored
+func (f *Fake) declare(topo *rmq.Topology) error {
+	for _, e := range topo.Exchanges {
+		if err := f.ExchangeDeclare(e.Name, e.Opts, nil); err != nil {
+			return err
+		}
+	}
+	for _, q := range topo.Queues {
+		if _, err := f.QueueDeclare(q.Name, q.Opts, nil); err != nil {
+			return err
+		}
+	}
+	for _, b := range topo.QueueBindings {
+		if err := f.QueueBind(b.Exchange, b.Queue, b.Key, b.Opts, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next takes the first message of q with the correlation ID, if given,
+// waiting for one until ctx is done
+func (f *Fake) next(ctx context.Context, q *queue, correlationID string) (amqp.Delivery, bool) {
+	for {
+		f.mu.Lock()
+		for i, msg := range q.msgs {
+			if len(msg.Body) == 0 {
+				continue
+			}
+			if correlationID != "" && msg.CorrelationId != correlationID {
+				continue
+			}
+			q.msgs = append(q.msgs[:i:i], q.msgs[i+1:]...)
+			f.mu.Unlock()
+			return msg, true
+		}
+		ready := q.ready
+		f.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return amqp.Delivery{}, false
+		}
+	}
+}
+
+// Shutdown does nothing, the fake holds no connections
+func (f *Fake) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, the fake holds no connections
+func (f *Fake) Close() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package rmqfake_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/raghuP9/amqp/pkg/rpc/rmq"
+	"github.com/raghuP9/amqp/pkg/rpc/rmqfake"
+	"github.com/streadway/amqp"
+)
+
+func TestSubscribeReplyRoundTrip(t *testing.T) {
+	f := rmqfake.New()
+	for _, name := range []string{"requests", "replies"} {
+		if _, err := f.QueueDeclare(name, nil, nil); err != nil {
+			t.Fatalf("declare queue %s: %v", name, err)
+		}
+	}
+
+	request := amqp.Publishing{
+		Body:          []byte("ping"),
+		ReplyTo:       "replies",
+		CorrelationId: "req-1",
+	}
+	if err := f.Publish(request, "", "requests", nil, nil); err != nil {
+		t.Fatalf("publish request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := rmq.DefaultSubscribeOpts()
+	opts.PublishResponse = true
+	err := f.Subscribe(ctx, "requests", opts, nil, nil,
+		func(msg amqp.Delivery) (amqp.Publishing, error) {
+			return amqp.Publishing{Body: append([]byte("pong: "), msg.Body...)}, nil
+		})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	replies := f.Messages("replies")
+	if len(replies) != 1 {
+		t.Fatalf("got %d replies, want 1", len(replies))
+	}
+	if got := string(replies[0].Body); got != "pong: ping" {
+		t.Errorf("reply body = %q, want %q", got, "pong: ping")
+	}
+	if got := replies[0].CorrelationId; got != "req-1" {
+		t.Errorf("reply correlation ID = %q, want %q", got, "req-1")
+	}
+	if n := len(f.Messages("requests")); n != 0 {
+		t.Errorf("%d requests left in the queue, want 0", n)
+	}
+}
@@ -8,13 +8,16 @@ import (
 )
 
 // RabbitMQRPC ...
+//
+// It is implemented by *rmq.Client and, for tests, by *rmqfake.Fake.
 type RabbitMQRPC interface {
 	ExchangeDeclare(string, *rmq.DeclareExchangeOpts, *rmq.ConnectOpts) error
 	ExchangeDelete(string, bool, bool, *rmq.ConnectOpts) error
 	QueueDeclare(string, *rmq.DeclareQueueOpts, *rmq.ConnectOpts) (amqp.Queue, error)
 	QueueBind(string, string, string, *rmq.QueueBindOpts, *rmq.ConnectOpts) error
-	QueuePurge(string, bool, *rmq.ConnectOpts) error
-	QueueDelete(string, *rmq.QueueDeleteOpts, *rmq.ConnectOpts) error
+	QueueUnbind(string, string, string, amqp.Table, *rmq.ConnectOpts) error
+	QueuePurge(string, bool, *rmq.ConnectOpts) (int, error)
+	QueueDelete(string, *rmq.QueueDeleteOpts, *rmq.ConnectOpts) (int, error)
 	Publish(amqp.Publishing, string, string, *rmq.PublishOpts, *rmq.ConnectOpts) error
 	Subscribe(
 		context.Context,
@@ -24,4 +27,8 @@ type RabbitMQRPC interface {
 		*rmq.ConnectOpts,
 		func(amqp.Delivery) (amqp.Publishing, error),
 	) error
+	Shutdown(context.Context) error
+	Close() error
 }
+
+var _ RabbitMQRPC = (*rmq.Client)(nil)